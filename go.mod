@@ -11,6 +11,8 @@ require (
 	github.com/prometheus/procfs v0.15.1
 	github.com/yandex-cloud/go-genproto v0.0.0-20250203115010-0bcba64c41f6
 	github.com/yandex-cloud/go-sdk v0.0.0-20250203123950-24786ecffd92
+	golang.org/x/net v0.34.0
+	golang.org/x/sys v0.30.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -25,8 +27,6 @@ require (
 	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
 	github.com/prometheus/client_model v0.6.1 // indirect
 	github.com/prometheus/common v0.62.0 // indirect
-	golang.org/x/net v0.34.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 	google.golang.org/genproto v0.0.0-20250207221924-e9438ea467c6 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20250207221924-e9438ea467c6 // indirect
@@ -15,6 +15,7 @@ import (
 	"github.com/orangeAppsRu/custom-exporter/pkg/network"
 	"github.com/orangeAppsRu/custom-exporter/pkg/proc"
 	"github.com/orangeAppsRu/custom-exporter/pkg/puppet"
+	"github.com/orangeAppsRu/custom-exporter/pkg/sockets"
 	"github.com/orangeAppsRu/custom-exporter/pkg/system"
 	"github.com/orangeAppsRu/custom-exporter/pkg/hetznercloud"
 	"github.com/orangeAppsRu/custom-exporter/pkg/yandex"
@@ -93,47 +94,107 @@ func main() {
 	if cfg.PortCollector.Enabled {
 		go func() {
 			for {
-				rTargets := network.CheckTargets(cfg.PortCollector.Targets)
+				rTargets := network.CheckTargets(cfg.PortCollector.Targets, cfg.PortCollector.MaxConcurrency)
 				metrics.UpdateNetworkTargetsMetrics(rTargets)
 				time.Sleep(60 * time.Second)
 			}
 		}()
 	}
 
-	if cfg.ProcessCollector.Enabled {
+	if cfg.ListenCollector.Enabled {
 		go func() {
-			procCollector := metrics.GetCustomProcCollector()
 			for {
-				if np, err := proc.CountProcesses(); err != nil {
-					fmt.Printf("Error counting processes: %v\n", err)
+				if listeners, err := sockets.FindListeners(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error finding listening sockets: %v\n", err)
 				} else {
-					metrics.UpdateProcessCountMetrics("all", np)
+					expected, unexpected := sockets.MatchExpectedListeners(listeners, cfg.ListenCollector.Expected)
+					metrics.UpdateListeningSocketsMetrics(listeners, expected, unexpected)
 				}
+				time.Sleep(60 * time.Second)
+			}
+		}()
+	}
 
-				if npt, err := proc.CountProcessTypes(); err != nil {
-					fmt.Printf("Error counting processes: %v\n", err)
+	if cfg.SocketStatsCollector.Enabled {
+		go func() {
+			for {
+				if tcpStats, err := sockets.CountTCPStates(cfg.SocketStatsCollector.LocalPorts, cfg.SocketStatsCollector.RemotePorts); err != nil {
+					fmt.Fprintf(os.Stderr, "Error counting TCP sockets: %v\n", err)
 				} else {
-					for typeProcess, count := range npt {
-						metrics.UpdateProcessCountMetrics(typeProcess, count)
-					}
+					metrics.UpdateTCPStatsMetrics(tcpStats)
 				}
 
-				if processResources, err := proc.AggregateCPUTimeAndMemoryUsageByRegex(cfg.ProcessCollector.Processes); err != nil {
-					fmt.Printf("Error aggregating process resources: %v\n", err)
+				if sockstat, err := sockets.ReadSockstat(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error reading sockstat: %v\n", err)
 				} else {
-					for process, usage := range processResources {
-						procCollector.Update("cpu_time", process, usage.CPUTime)
-						metrics.UpdateProcessMemoryResidentMetrics(process, usage.ResidentMemory)
-					}
+					metrics.UpdateSockstatMetrics(sockstat)
 				}
 
-				if processRunningStatus, err := proc.FindProcessesByRegex(cfg.ProcessCollector.Processes); err != nil {
-					fmt.Printf("Error finding processes: %v\n", err)
-				} else {
-					for process, count := range processRunningStatus {
-						metrics.UpdateProcessRunningStatusMetrics(process, count)
+				if conntrack, err := sockets.ReadConntrack(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error reading conntrack usage: %v\n", err)
+				} else if conntrack != nil {
+					metrics.UpdateConntrackMetrics(conntrack)
+				}
+
+				time.Sleep(15 * time.Second)
+			}
+		}()
+	}
+
+	if cfg.ProcessCollector.Enabled {
+		go func() {
+			restartTracker := proc.NewRestartTracker()
+			usageTracker := proc.NewUsageTracker()
+			processPidCollector := metrics.GetProcessPidCollector()
+			topTracker := proc.NewTopTracker()
+			processTopCollector := metrics.GetProcessTopCollector()
+			stuckTracker := proc.NewStuckTracker()
+			processStuckCollector := metrics.GetProcessStuckCollector()
+			for {
+				snapshot, err := proc.TakeSnapshot()
+				if err != nil {
+					fmt.Printf("Error reading processes: %v\n", err)
+					metrics.AddProcessScanErrors(1)
+					time.Sleep(15 * time.Second)
+					continue
+				}
+
+				metrics.UpdateProcessCountMetrics("all", snapshot.CountProcesses())
+				for typeProcess, count := range snapshot.CountProcessTypes() {
+					metrics.UpdateProcessCountMetrics(typeProcess, count)
+				}
+
+				groups := snapshot.MatchProcesses(cfg.ProcessCollector.Processes)
+				for process, count := range restartTracker.Update(groups) {
+					metrics.AddProcessRestarts(process, count)
+				}
+				for _, filter := range cfg.ProcessCollector.Processes {
+					process, processes := filter.Process, groups[filter.Process]
+					metrics.UpdateProcessGroupMetrics(process, usageTracker.Update(process, processes))
+					if filter.HasExpectedCount() {
+						metrics.UpdateProcessCountWithinExpectedMetrics(process, filter.CountWithinExpected(len(processes)))
+					}
+					if filter.SmapsRollup {
+						metrics.UpdateProcessMemoryMetrics(process, proc.AggregateMemory(processes))
 					}
+					if filter.PerPid {
+						processPidCollector.Update(process, proc.SampleProcesses(processes, filter.MaxPidSeries))
+					}
+
+					running := 0
+					if len(processes) > 0 {
+						running = 1
+					}
+					metrics.UpdateProcessRunningStatusMetrics(process, running)
+				}
+				if cfg.ProcessCollector.TopN > 0 {
+					processTopCollector.Update(topTracker.Top(snapshot, cfg.ProcessCollector.TopN))
+				}
+				if cfg.ProcessCollector.StuckProcesses.Enabled {
+					processStuckCollector.Update(stuckTracker.Update(snapshot, cfg.ProcessCollector.StuckProcesses.Wchan))
 				}
+				// includes errors of attributes read while matching filters
+				metrics.AddProcessScanErrors(snapshot.ScanErrors)
 
 				time.Sleep(15 * time.Second)
 			}
@@ -142,20 +203,48 @@ func main() {
 
 	if cfg.SystemCollector.Enabled {
 		systemCollector := metrics.GetSystemCollector()
+		loginSessionsCollector := metrics.GetLoginSessionsCollector()
 		go func() {
 			for {
-				// hostname checksum
-				if hostnameChecksum, err := system.HostnameChecksum(); err != nil {
-					fmt.Fprintf(os.Stderr, "Error getting hostname: %v\n", err)
+				if *cfg.SystemCollector.LegacyChecksums {
+					// hostname checksum
+					if hostnameChecksum, err := system.HostnameChecksum(); err != nil {
+						fmt.Fprintf(os.Stderr, "Error getting hostname: %v\n", err)
+					} else {
+						metrics.UpdateHostnameChecksumMetrics(hostnameChecksum)
+					}
+
+					// uname checksum
+					if unameChecksum, err := system.UnameChecksum(); err != nil {
+						fmt.Fprintf(os.Stderr, "Error getting uname: %v\n", err)
+					} else {
+						metrics.UpdateUnameChecksumMetrics(unameChecksum)
+					}
+				}
+
+				// os and kernel
+				if osInfo, err := system.ReadOSInfo(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error getting os info: %v\n", err)
+				} else {
+					metrics.UpdateOSInfoMetrics(osInfo)
+				}
+				if kernelInfo, err := system.ReadKernelInfo(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error getting kernel info: %v\n", err)
 				} else {
-					metrics.UpdateHostnameChecksumMetrics(hostnameChecksum)
+					metrics.UpdateKernelInfoMetrics(kernelInfo)
+
+					if outdated, newest, err := system.KernelOutdated(kernelInfo.Release); err != nil {
+						fmt.Fprintf(os.Stderr, "Error getting installed kernels: %v\n", err)
+					} else if newest != "" {
+						metrics.UpdateKernelOutdatedMetrics(outdated, newest)
+					}
 				}
 
-				// uname checksum
-				if unameChecksum, err := system.UnameChecksum(); err != nil {
-					fmt.Fprintf(os.Stderr, "Error getting uname: %v\n", err)
+				// reboot required
+				if rebootRequired, err := system.CheckRebootRequired(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error checking reboot-required: %v\n", err)
 				} else {
-					metrics.UpdateUnameChecksumMetrics(unameChecksum)
+					metrics.UpdateRebootRequiredMetrics(rebootRequired)
 				}
 
 				// hostname
@@ -172,11 +261,12 @@ func main() {
 					systemCollector.Update("uptime_seconds", uptime)
 				}
 
-				// count of login users
-				if countLoginUsers, err := system.CountLoginUsers(); err != nil {
-					fmt.Fprintf(os.Stderr, "Error getting count of login users: %v\n", err)
+				// login sessions
+				if sessions, err := system.ReadLoginSessions(cfg.SystemCollector.UtmpPath); err != nil {
+					fmt.Fprintf(os.Stderr, "Error getting login sessions: %v\n", err)
 				} else {
-					metrics.UpdateLoginUsersCountMetrics(countLoginUsers)
+					metrics.UpdateLoginUsersCountMetrics(len(sessions))
+					loginSessionsCollector.Update(sessions)
 				}
 
 				time.Sleep(60 * time.Second)
@@ -3,10 +3,13 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	yaml "gopkg.in/yaml.v3"
     "github.com/orangeAppsRu/custom-exporter/pkg/network"
     "github.com/orangeAppsRu/custom-exporter/pkg/proc"
+    "github.com/orangeAppsRu/custom-exporter/pkg/sockets"
+    "github.com/orangeAppsRu/custom-exporter/pkg/system"
 )
 
 const (
@@ -21,16 +24,43 @@ type Config struct {
 
     PortCollector struct {
         Enabled bool     `yaml:"enabled"`
+        Timeout time.Duration `yaml:"timeout"`
+        Retries int `yaml:"retries"`
+        RetryInterval time.Duration `yaml:"retryInterval"`
+        MaxConcurrency int `yaml:"maxConcurrency"`
         Targets []network.Target `yaml:"targets"`
     } `yaml:"portCollector"`
 
+    ListenCollector struct {
+        Enabled bool     `yaml:"enabled"`
+        Expected []sockets.ExpectedListener `yaml:"expected"`
+    } `yaml:"listenCollector"`
+
+    SocketStatsCollector struct {
+        Enabled bool     `yaml:"enabled"`
+        LocalPorts []uint16 `yaml:"localPorts"`
+        RemotePorts []uint16 `yaml:"remotePorts"`
+    } `yaml:"socketStatsCollector"`
+
     ProcessCollector struct {
         Enabled bool     `yaml:"enabled"`
         Processes []proc.ProcessFilter `yaml:"processes"`
+        // number of processes exported by CPU usage and by resident memory, 0 disables the top
+        TopN int `yaml:"topN"`
+        StuckProcesses struct {
+            Enabled bool `yaml:"enabled"`
+            // count D-state processes by wchan
+            Wchan bool `yaml:"wchan"`
+        } `yaml:"stuckProcesses"`
     } `yaml:"processCollector"`
 
     SystemCollector struct {
         Enabled bool `yaml:"enabled"`
+        // path of the utmp file, e.g. of the host mounted into a container
+        UtmpPath string `yaml:"utmpPath"`
+        // export hostname_checksum and uname_checksum, enabled if not set;
+        // uname_checksum hashes the uname -a output like earlier versions
+        LegacyChecksums *bool `yaml:"legacyChecksums"`
     } `yaml:"systemCollector"`
 
     
@@ -75,5 +105,42 @@ func ReadConfig(filePath string) (Config, error) {
     if config.PuppetCollector.LastRunReportPath == "" {
         config.PuppetCollector.LastRunReportPath = lastRunReportPath
     }
+    if config.SystemCollector.UtmpPath == "" {
+        config.SystemCollector.UtmpPath = system.DefaultUtmpPath
+    }
+    if config.SystemCollector.LegacyChecksums == nil {
+        legacyChecksums := true
+        config.SystemCollector.LegacyChecksums = &legacyChecksums
+    }
+    if err := network.ValidateTargets(config.PortCollector.Targets); err != nil {
+        return Config{}, fmt.Errorf("error in portCollector config: %v", err)
+    }
+    if config.PortCollector.MaxConcurrency == 0 {
+        config.PortCollector.MaxConcurrency = network.DefaultMaxConcurrency
+    }
+    for i := range config.PortCollector.Targets {
+        t := &config.PortCollector.Targets[i]
+        if t.Timeout == 0 {
+            t.Timeout = config.PortCollector.Timeout
+        }
+        if t.Retries == nil {
+            retries := config.PortCollector.Retries
+            t.Retries = &retries
+        }
+        // without an interval of the collector the default of the network package is used
+        if t.RetryInterval == nil && config.PortCollector.RetryInterval != 0 {
+            retryInterval := config.PortCollector.RetryInterval
+            t.RetryInterval = &retryInterval
+        }
+    }
+    if err := proc.CompileProcessFilters(config.ProcessCollector.Processes); err != nil {
+        return Config{}, fmt.Errorf("error in processCollector config: %v", err)
+    }
+    if config.ProcessCollector.TopN < 0 {
+        return Config{}, fmt.Errorf("error in processCollector config: topN must not be negative")
+    }
+    if err := sockets.ValidateExpectedListeners(config.ListenCollector.Expected); err != nil {
+        return Config{}, fmt.Errorf("error in listenCollector config: %v", err)
+    }
     return config, nil
 }
@@ -2,16 +2,18 @@ package metrics
 
 import (
 	"strconv"
+	"strings"
 	"sync"
 	"reflect"
 	"time"
 	"fmt"
+	"os"
 
 	"github.com/orangeAppsRu/custom-exporter/pkg/config"
 	"github.com/orangeAppsRu/custom-exporter/pkg/filehash"
-	"github.com/orangeAppsRu/custom-exporter/pkg/network"
 	"github.com/orangeAppsRu/custom-exporter/pkg/hetzner"
 	"github.com/orangeAppsRu/custom-exporter/pkg/hetznercloud"
+	"github.com/orangeAppsRu/custom-exporter/pkg/system"
 	"github.com/orangeAppsRu/custom-exporter/pkg/yandex"
 	"github.com/orangeAppsRu/custom-exporter/pkg/aws"
 
@@ -28,14 +30,6 @@ var (
 		[]string{"file"},
 	)
 
-	networkTargetGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "network_target",
-			Help: "Network port availability",
-		},
-		[]string{"host", "port", "protocol"},
-	)
-
 	processCountGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "processes_count",
@@ -54,6 +48,13 @@ var (
 
 	procCollector = NewCustomProcCollector()
 
+	processScanErrorsCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "process_scan_errors_total",
+			Help: "Number of errors reading processes, except processes exited during the scan",
+		},
+	)
+
 	processMemoryResidentGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "process_memory_resident",
@@ -84,6 +85,54 @@ var (
 		},
 	)
 
+	osInfoGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "os_info",
+			Help: "Operating system from os-release",
+		},
+		[]string{"id", "version", "codename"},
+	)
+	osInfoLabels = make(map[string]prometheus.Labels)
+
+	kernelInfoGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kernel_info",
+			Help: "Running kernel from uname",
+		},
+		[]string{"release", "version", "machine"},
+	)
+	kernelInfoLabels = make(map[string]prometheus.Labels)
+
+	rebootRequiredGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "reboot_required",
+			Help: "Reboot is required by installed updates (/var/run/reboot-required exists)",
+		},
+	)
+
+	rebootRequiredPackagesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "reboot_required_packages",
+			Help: "Number of packages which require a reboot",
+		},
+	)
+
+	kernelOutdatedGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "kernel_outdated",
+			Help: "Running kernel is older than the newest installed kernel",
+		},
+	)
+
+	kernelNewestInstalledGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kernel_newest_installed_info",
+			Help: "Newest kernel of the flavor of the running kernel installed under /boot or /lib/modules",
+		},
+		[]string{"release"},
+	)
+	kernelNewestInstalledLabels = make(map[string]prometheus.Labels)
+
 	systemCollector = NewCustomSystemCollector()
 
 	countLoginUsersGauge = prometheus.NewGauge(
@@ -144,13 +193,13 @@ var (
 	previousHostnameLabel string
 
 	fileHashMutex sync.Mutex
-	networkTargetMutex sync.Mutex
 	processCountMutex sync.Mutex
 	processMemoryResidentMutex sync.Mutex
 	processRunningStatusMutex sync.Mutex
 	hostnameChecksumMutex sync.Mutex
 	hostnameMutex sync.Mutex
 	unameChecksumMutex sync.Mutex
+	systemInfoMutex sync.Mutex
 	countLoginUsersMutex sync.Mutex
 	puppetCatalogLastCompileTimestampMutex sync.Mutex
 	puppetCatalogLastCompileStatusMutex sync.Mutex
@@ -238,6 +287,48 @@ func NewCustomProcCollector() *CustomProcCollector {
 				[]string{"process"},
 				nil,
 			),
+			"cpu_user_time": prometheus.NewDesc(
+				"process_cpu_user_seconds_total",
+				"User CPU time consumed by processes in seconds",
+				[]string{"process"},
+				nil,
+			),
+			"cpu_system_time": prometheus.NewDesc(
+				"process_cpu_system_seconds_total",
+				"System CPU time consumed by processes in seconds",
+				[]string{"process"},
+				nil,
+			),
+			"io_read_bytes": prometheus.NewDesc(
+				"process_io_read_bytes_total",
+				"Bytes read from storage by processes",
+				[]string{"process"},
+				nil,
+			),
+			"io_write_bytes": prometheus.NewDesc(
+				"process_io_write_bytes_total",
+				"Bytes written to storage by processes",
+				[]string{"process"},
+				nil,
+			),
+			"voluntary_ctx_switches": prometheus.NewDesc(
+				"process_voluntary_ctx_switches_total",
+				"Voluntary context switches of processes",
+				[]string{"process"},
+				nil,
+			),
+			"involuntary_ctx_switches": prometheus.NewDesc(
+				"process_involuntary_ctx_switches_total",
+				"Involuntary context switches of processes",
+				[]string{"process"},
+				nil,
+			),
+			"major_faults": prometheus.NewDesc(
+				"process_major_page_faults_total",
+				"Major page faults of processes",
+				[]string{"process"},
+				nil,
+			),
 		},
 		values: make(map[string]map[string]float64),
 	}
@@ -288,7 +379,20 @@ func RegistrMetrics(cfg config.Config) {
 	}
 
 	if cfg.PortCollector.Enabled {
-		prometheus.MustRegister(networkTargetGauge)
+		registerNetworkTargetMetrics(cfg.PortCollector.Targets)
+	}
+
+	if cfg.ListenCollector.Enabled {
+		prometheus.MustRegister(listeningSocketInfoGauge)
+		prometheus.MustRegister(listeningSocketUnexpectedGauge)
+		prometheus.MustRegister(listeningSocketExpectedGauge)
+	}
+
+	if cfg.SocketStatsCollector.Enabled {
+		prometheus.MustRegister(tcpConnectionsGauge)
+		prometheus.MustRegister(tcpConnectionsByLocalPortGauge)
+		prometheus.MustRegister(tcpConnectionsByRemotePortGauge)
+		prometheus.MustRegister(sockstatGauge)
 	}
 
 	if cfg.ProcessCollector.Enabled {
@@ -296,14 +400,53 @@ func RegistrMetrics(cfg config.Config) {
 		prometheus.MustRegister(processMemoryResidentGauge)
 		prometheus.MustRegister(processRunningStatusGauge)
 		prometheus.MustRegister(procCollector)
+		prometheus.MustRegister(processScanErrorsCounter)
+		prometheus.MustRegister(processGroupCountGauge)
+		prometheus.MustRegister(processGroupThreadsGauge)
+		prometheus.MustRegister(processGroupOpenFDsGauge)
+		prometheus.MustRegister(processGroupFDsUsageRatioGauge)
+		prometheus.MustRegister(processGroupOldestStartTimeGauge)
+		prometheus.MustRegister(processGroupNewestStartTimeGauge)
+		prometheus.MustRegister(processGroupRestartsCounter)
+		prometheus.MustRegister(processCountWithinExpectedGauge)
+		if cfg.ProcessCollector.TopN > 0 {
+			prometheus.MustRegister(processTopCollector)
+		}
+		if cfg.ProcessCollector.StuckProcesses.Enabled {
+			prometheus.MustRegister(processStuckCollector)
+		}
+		for _, filter := range cfg.ProcessCollector.Processes {
+			if filter.PerPid {
+				prometheus.MustRegister(processPidCollector)
+				break
+			}
+		}
+		for _, filter := range cfg.ProcessCollector.Processes {
+			if filter.SmapsRollup {
+				prometheus.MustRegister(processMemoryPSSGauge)
+				prometheus.MustRegister(processMemoryUSSGauge)
+				prometheus.MustRegister(processMemorySharedGauge)
+				prometheus.MustRegister(processMemorySwapGauge)
+				break
+			}
+		}
 	}
 
 	if cfg.SystemCollector.Enabled {
-		prometheus.MustRegister(hostnameChecksumGauge)
+		if *cfg.SystemCollector.LegacyChecksums {
+			prometheus.MustRegister(hostnameChecksumGauge)
+			prometheus.MustRegister(unameChecksumGauge)
+		}
 		prometheus.MustRegister(hostnameGauge)
-		prometheus.MustRegister(unameChecksumGauge)
+		prometheus.MustRegister(osInfoGauge)
+		prometheus.MustRegister(kernelInfoGauge)
+		prometheus.MustRegister(rebootRequiredGauge)
+		prometheus.MustRegister(rebootRequiredPackagesGauge)
+		prometheus.MustRegister(kernelOutdatedGauge)
+		prometheus.MustRegister(kernelNewestInstalledGauge)
 		prometheus.MustRegister(countLoginUsersGauge)
 		prometheus.MustRegister(systemCollector)
+		prometheus.MustRegister(loginSessionsCollector)
 
 	}
 
@@ -333,6 +476,64 @@ func compareLabels(a, b prometheus.Labels) bool {
     return reflect.DeepEqual(a, b)
 }
 
+// setInfoMetric sets an info series for key and removes the series exported
+// earlier for the same key if its labels have changed
+func setInfoMetric(gauge *prometheus.GaugeVec, previous map[string]prometheus.Labels, key string, labels prometheus.Labels) {
+	if old, exists := previous[key]; exists && !compareLabels(old, labels) {
+		gauge.Delete(old)
+	}
+	gauge.With(labels).Set(1)
+	previous[key] = labels
+}
+
+// deleteInfoMetric removes the info series exported earlier for key
+func deleteInfoMetric(gauge *prometheus.GaugeVec, previous map[string]prometheus.Labels, key string) {
+	if old, exists := previous[key]; exists {
+		gauge.Delete(old)
+		delete(previous, key)
+	}
+}
+
+func copyLabels(labels prometheus.Labels) prometheus.Labels {
+	result := make(prometheus.Labels, len(labels))
+	for k, v := range labels {
+		result[k] = v
+	}
+	return result
+}
+
+// validLabelValue replaces invalid UTF-8 in a label value, names of
+// processes, users and hosts are set by the system and may contain any bytes
+func validLabelValue(value string) string {
+	return strings.ToValidUTF8(value, "?")
+}
+
+// gaugeWith returns the gauge of the labels after replacing invalid UTF-8 in
+// the label values, the values are replaced in place so the labels can be
+// used to delete the series later
+func gaugeWith(gauge *prometheus.GaugeVec, labels prometheus.Labels) prometheus.Gauge {
+	for name, value := range labels {
+		labels[name] = validLabelValue(value)
+	}
+	return gauge.With(labels)
+}
+
+// sendConstMetric sends a const metric with valid label values to the
+// channel, a series which still can not be created is skipped instead of
+// failing the whole scrape
+func sendConstMetric(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labelValues ...string) {
+	validValues := make([]string, len(labelValues))
+	for i, labelValue := range labelValues {
+		validValues[i] = validLabelValue(labelValue)
+	}
+	metric, err := prometheus.NewConstMetric(desc, valueType, value, validValues...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "metrics: skip series %v of %s: %v\n", labelValues, desc, err)
+		return
+	}
+	ch <- metric
+}
+
 func UpdateFileHashMetrics(filesWithHash []filehash.FileHash) {
 	for _, fileInfo := range filesWithHash {
 		fileHashMutex.Lock()
@@ -341,22 +542,6 @@ func UpdateFileHashMetrics(filesWithHash []filehash.FileHash) {
 	}
 }
 
-func UpdateNetworkTargetsMetrics(targets []network.ResultTarget) {
-	for _, t := range targets {
-		value := 0
-		if t.IsOpen {
-			value = 1
-		}
-		networkTargetMutex.Lock()
-		networkTargetGauge.With(prometheus.Labels{
-			"host": t.Host,
-			"port": strconv.Itoa(int(t.Port)),
-			"protocol": t.Protocol,
-		}).Set(float64(value))
-		networkTargetMutex.Unlock()
-	}
-}
-
 func UpdateProcessCountMetrics(typeProcess string, count int) {
 	processCountMutex.Lock()
 	processCountGauge.WithLabelValues(typeProcess).Set(float64(count))
@@ -375,6 +560,10 @@ func UpdateProcessRunningStatusMetrics(process string, status int) {
 	processRunningStatusMutex.Unlock()
 }
 
+func AddProcessScanErrors(count int) {
+	processScanErrorsCounter.Add(float64(count))
+}
+
 func UpdateHostnameChecksumMetrics(checksum float64) {
 	hostnameChecksumMutex.Lock()
 	hostnameChecksumGauge.Set(checksum)
@@ -397,6 +586,50 @@ func UpdateUnameChecksumMetrics(checksum float64) {
 	unameChecksumMutex.Unlock()
 }
 
+func UpdateOSInfoMetrics(info system.OSInfo) {
+	systemInfoMutex.Lock()
+	defer systemInfoMutex.Unlock()
+	setInfoMetric(osInfoGauge, osInfoLabels, "os", prometheus.Labels{
+		"id":       info.ID,
+		"version":  info.Version,
+		"codename": info.Codename,
+	})
+}
+
+func UpdateKernelInfoMetrics(info system.KernelInfo) {
+	systemInfoMutex.Lock()
+	defer systemInfoMutex.Unlock()
+	setInfoMetric(kernelInfoGauge, kernelInfoLabels, "kernel", prometheus.Labels{
+		"release": info.Release,
+		"version": info.Version,
+		"machine": info.Machine,
+	})
+}
+
+func UpdateRebootRequiredMetrics(rebootRequired system.RebootRequired) {
+	systemInfoMutex.Lock()
+	defer systemInfoMutex.Unlock()
+	value := 0.0
+	if rebootRequired.Required {
+		value = 1
+	}
+	rebootRequiredGauge.Set(value)
+	rebootRequiredPackagesGauge.Set(float64(rebootRequired.Packages))
+}
+
+func UpdateKernelOutdatedMetrics(outdated bool, newestRelease string) {
+	systemInfoMutex.Lock()
+	defer systemInfoMutex.Unlock()
+	value := 0.0
+	if outdated {
+		value = 1
+	}
+	kernelOutdatedGauge.Set(value)
+	setInfoMetric(kernelNewestInstalledGauge, kernelNewestInstalledLabels, "kernel", prometheus.Labels{
+		"release": newestRelease,
+	})
+}
+
 func UpdateLoginUsersCountMetrics(count int) {
 	countLoginUsersMutex.Lock()
 	countLoginUsersGauge.Set(float64(count))
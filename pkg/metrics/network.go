@@ -0,0 +1,404 @@
+package metrics
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/orangeAppsRu/custom-exporter/pkg/network"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Port collector metrics are created in registerNetworkTargetMetrics because
+// their label names depend on the custom labels of configured targets.
+var (
+	networkTargetGauge                  *prometheus.GaugeVec
+	networkTargetClosedGauge            *prometheus.GaugeVec
+	networkTargetConnectDurationGauge   *prometheus.GaugeVec
+	networkTargetPhaseDurationGauge     *prometheus.GaugeVec
+	networkTargetPhaseDurationHistogram *prometheus.HistogramVec
+
+	networkTargetScriptSuccessGauge    *prometheus.GaugeVec
+	networkTargetScriptFailedStepGauge *prometheus.GaugeVec
+
+	tlsHandshakeSuccessGauge *prometheus.GaugeVec
+	tlsCertNotAfterGauge     *prometheus.GaugeVec
+	tlsCertVerifiedGauge     *prometheus.GaugeVec
+	tlsCertInfoGauge         *prometheus.GaugeVec
+	tlsCertInfoLabels        = make(map[string]prometheus.Labels)
+	tlsVersionGauge          *prometheus.GaugeVec
+	tlsVersionLabels         = make(map[string]prometheus.Labels)
+
+	httpProbeSuccessGauge       *prometheus.GaugeVec
+	httpProbeStatusCodeGauge    *prometheus.GaugeVec
+	httpProbeDurationGauge      *prometheus.GaugeVec
+	httpProbeContentLengthGauge *prometheus.GaugeVec
+
+	dnsProbeSuccessGauge  *prometheus.GaugeVec
+	dnsProbeDurationGauge *prometheus.GaugeVec
+	dnsProbeAnswersGauge  *prometheus.GaugeVec
+	dnsProbeRcodeGauge    *prometheus.GaugeVec
+
+	icmpProbeSuccessGauge   *prometheus.GaugeVec
+	icmpProbeLossRatioGauge *prometheus.GaugeVec
+	icmpProbeRTTMinGauge    *prometheus.GaugeVec
+	icmpProbeRTTAvgGauge    *prometheus.GaugeVec
+	icmpProbeRTTMaxGauge    *prometheus.GaugeVec
+	icmpProbeJitterGauge    *prometheus.GaugeVec
+
+	// labels added to every port collector metric
+	targetLabelNames []string
+
+	// labels of TCP and UDP target series exported in the last cycle by
+	// labelsKey, addresses of targets with resolveAll change between cycles
+	networkTargetLabels = make(map[string]prometheus.Labels)
+
+	networkTargetMutex sync.Mutex
+	tlsMutex           sync.Mutex
+	httpProbeMutex     sync.Mutex
+	dnsProbeMutex      sync.Mutex
+	icmpProbeMutex     sync.Mutex
+)
+
+func newTargetGaugeVec(name string, help string, labels ...string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: name,
+			Help: help,
+		},
+		append(labels, targetLabelNames...),
+	)
+}
+
+func registerNetworkTargetMetrics(targets []network.Target) {
+	targetLabelNames = append([]string{"name", "group"}, network.CustomLabelNames(targets)...)
+
+	networkTargetGauge = newTargetGaugeVec("network_target", "Network port availability", "host", "port", "protocol", "ip")
+	networkTargetClosedGauge = newTargetGaugeVec("network_target_closed", "Network port actively refused the probe (TCP reset or ICMP port unreachable)", "host", "port", "protocol", "ip")
+	networkTargetConnectDurationGauge = newTargetGaugeVec("network_target_connect_duration_seconds", "Duration of TCP connect to network target in seconds", "host", "port", "protocol", "ip")
+	networkTargetPhaseDurationGauge = newTargetGaugeVec("network_target_phase_duration_seconds", "Duration of network target probe phases (resolve, connect, tls) in seconds", "host", "port", "protocol", "ip", "phase")
+	networkTargetPhaseDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "network_target_phase_duration_histogram_seconds",
+			Help:    "Histogram of network target probe phase (resolve, connect, tls) durations in seconds",
+			Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+		},
+		append([]string{"host", "port", "protocol", "ip", "phase"}, targetLabelNames...),
+	)
+
+	networkTargetScriptSuccessGauge = newTargetGaugeVec("network_target_script_success", "Status of send/expect script of network target", "host", "port", "protocol", "ip")
+	networkTargetScriptFailedStepGauge = newTargetGaugeVec("network_target_script_failed_step", "Number of the failed send/expect script step starting from 1, 0 if the script passed", "host", "port", "protocol", "ip")
+
+	tlsHandshakeSuccessGauge = newTargetGaugeVec("tls_handshake_success", "Status of TLS handshake with network target", "host", "port", "protocol", "ip", "server_name")
+	tlsCertNotAfterGauge = newTargetGaugeVec("tls_cert_not_after_seconds", "Expiration timestamp of the TLS certificate presented by network target", "host", "port", "protocol", "ip", "server_name")
+	tlsCertVerifiedGauge = newTargetGaugeVec("tls_cert_verified", "Result of TLS certificate chain verification for network target", "host", "port", "protocol", "ip", "server_name")
+	tlsCertInfoGauge = newTargetGaugeVec("tls_cert_info", "Information about the TLS certificate presented by network target", "host", "port", "protocol", "ip", "server_name", "subject", "issuer", "dns_names", "serial")
+	tlsVersionGauge = newTargetGaugeVec("tls_version_info", "TLS version negotiated with network target", "host", "port", "protocol", "ip", "server_name", "version")
+
+	httpProbeSuccessGauge = newTargetGaugeVec("http_probe_success", "Status of HTTP probe", "url", "method")
+	httpProbeStatusCodeGauge = newTargetGaugeVec("http_probe_status_code", "Response HTTP status code of HTTP probe", "url", "method")
+	httpProbeDurationGauge = newTargetGaugeVec("http_probe_duration_seconds", "Response time of HTTP probe in seconds", "url", "method")
+	httpProbeContentLengthGauge = newTargetGaugeVec("http_probe_content_length", "Length of the response body of HTTP probe in bytes", "url", "method")
+
+	dnsProbeSuccessGauge = newTargetGaugeVec("dns_probe_success", "Status of DNS probe", "query", "type", "server")
+	dnsProbeDurationGauge = newTargetGaugeVec("dns_probe_duration_seconds", "Duration of DNS lookup in seconds", "query", "type", "server")
+	dnsProbeAnswersGauge = newTargetGaugeVec("dns_probe_answers_count", "Number of records in the answer section of DNS response", "query", "type", "server")
+	dnsProbeRcodeGauge = newTargetGaugeVec("dns_probe_rcode", "Response code of DNS response, -1 if no response was received", "query", "type", "server")
+
+	icmpProbeSuccessGauge = newTargetGaugeVec("icmp_probe_success", "Status of ICMP probe, 1 if at least one echo reply was received", "host", "ip")
+	icmpProbeLossRatioGauge = newTargetGaugeVec("icmp_probe_loss_ratio", "Ratio of lost ICMP echo requests", "host", "ip")
+	icmpProbeRTTMinGauge = newTargetGaugeVec("icmp_probe_rtt_min_seconds", "Minimum round trip time of ICMP echo requests in seconds", "host", "ip")
+	icmpProbeRTTAvgGauge = newTargetGaugeVec("icmp_probe_rtt_avg_seconds", "Average round trip time of ICMP echo requests in seconds", "host", "ip")
+	icmpProbeRTTMaxGauge = newTargetGaugeVec("icmp_probe_rtt_max_seconds", "Maximum round trip time of ICMP echo requests in seconds", "host", "ip")
+	icmpProbeJitterGauge = newTargetGaugeVec("icmp_probe_jitter_seconds", "Mean difference between consecutive round trip times of ICMP echo requests in seconds", "host", "ip")
+
+	prometheus.MustRegister(networkTargetGauge)
+	prometheus.MustRegister(networkTargetClosedGauge)
+	prometheus.MustRegister(networkTargetConnectDurationGauge)
+	prometheus.MustRegister(networkTargetPhaseDurationGauge)
+	prometheus.MustRegister(networkTargetPhaseDurationHistogram)
+	prometheus.MustRegister(networkTargetScriptSuccessGauge)
+	prometheus.MustRegister(networkTargetScriptFailedStepGauge)
+	prometheus.MustRegister(tlsHandshakeSuccessGauge)
+	prometheus.MustRegister(tlsCertNotAfterGauge)
+	prometheus.MustRegister(tlsCertVerifiedGauge)
+	prometheus.MustRegister(tlsCertInfoGauge)
+	prometheus.MustRegister(tlsVersionGauge)
+	prometheus.MustRegister(httpProbeSuccessGauge)
+	prometheus.MustRegister(httpProbeStatusCodeGauge)
+	prometheus.MustRegister(httpProbeDurationGauge)
+	prometheus.MustRegister(httpProbeContentLengthGauge)
+	prometheus.MustRegister(dnsProbeSuccessGauge)
+	prometheus.MustRegister(dnsProbeDurationGauge)
+	prometheus.MustRegister(dnsProbeAnswersGauge)
+	prometheus.MustRegister(dnsProbeRcodeGauge)
+	prometheus.MustRegister(icmpProbeSuccessGauge)
+	prometheus.MustRegister(icmpProbeLossRatioGauge)
+	prometheus.MustRegister(icmpProbeRTTMinGauge)
+	prometheus.MustRegister(icmpProbeRTTAvgGauge)
+	prometheus.MustRegister(icmpProbeRTTMaxGauge)
+	prometheus.MustRegister(icmpProbeJitterGauge)
+}
+
+// targetLabels returns the labels shared by all metrics of the target merged
+// with the metric specific labels
+func targetLabels(t network.ResultTarget, labels prometheus.Labels) prometheus.Labels {
+	result := copyLabels(labels)
+	result["name"] = t.Name
+	result["group"] = t.Group
+	for _, name := range targetLabelNames[2:] {
+		result[name] = t.Labels[name]
+	}
+	return result
+}
+
+func UpdateNetworkTargetsMetrics(targets []network.ResultTarget) {
+	current := make(map[string]prometheus.Labels)
+	defer deleteVanishedNetworkTargets(current)
+
+	for _, t := range targets {
+		if t.HTTP != nil {
+			updateHTTPProbeMetrics(t)
+			continue
+		}
+		if t.DNS != nil {
+			updateDNSProbeMetrics(t)
+			continue
+		}
+		if t.ICMP != nil {
+			updateICMPProbeMetrics(t)
+			continue
+		}
+
+		value := 0
+		if t.IsOpen {
+			value = 1
+		}
+		labels := targetLabels(t, prometheus.Labels{
+			"host":     t.Host,
+			"port":     strconv.Itoa(int(t.Port)),
+			"protocol": t.Protocol,
+			"ip":       t.IP,
+		})
+		current[labelsKey(labels)] = labels
+		networkTargetMutex.Lock()
+		networkTargetGauge.With(labels).Set(float64(value))
+		closed := 0
+		if t.Closed {
+			closed = 1
+		}
+		networkTargetClosedGauge.With(labels).Set(float64(closed))
+		// series of phases which were not reached are removed, a value of an
+		// earlier cycle would look current
+		if t.ConnectDuration > 0 {
+			networkTargetConnectDurationGauge.With(labels).Set(t.ConnectDuration.Seconds())
+		} else {
+			networkTargetConnectDurationGauge.Delete(labels)
+		}
+		if t.Script != nil {
+			success := 0
+			if t.Script.Success {
+				success = 1
+			}
+			networkTargetScriptSuccessGauge.With(labels).Set(float64(success))
+			networkTargetScriptFailedStepGauge.With(labels).Set(float64(t.Script.FailedStep))
+		} else {
+			networkTargetScriptSuccessGauge.Delete(labels)
+			networkTargetScriptFailedStepGauge.Delete(labels)
+		}
+		networkTargetMutex.Unlock()
+
+		updateNetworkTargetPhaseMetrics(labels, "resolve", t.ResolveDuration)
+		updateNetworkTargetPhaseMetrics(labels, "connect", t.ConnectDuration)
+		updateNetworkTargetPhaseMetrics(labels, "tls", t.TLSDuration)
+
+		if t.TLS != nil {
+			updateTLSMetrics(labels, t.TLS)
+		}
+	}
+}
+
+// deleteVanishedNetworkTargets removes all series of targets exported in the
+// previous cycle but not in the current one, e.g. addresses removed from DNS
+// or the address-less series of a failed resolve
+func deleteVanishedNetworkTargets(current map[string]prometheus.Labels) {
+	for key, labels := range networkTargetLabels {
+		if _, exists := current[key]; exists {
+			continue
+		}
+		networkTargetMutex.Lock()
+		networkTargetGauge.DeletePartialMatch(labels)
+		networkTargetClosedGauge.DeletePartialMatch(labels)
+		networkTargetConnectDurationGauge.DeletePartialMatch(labels)
+		networkTargetPhaseDurationGauge.DeletePartialMatch(labels)
+		networkTargetPhaseDurationHistogram.DeletePartialMatch(labels)
+		networkTargetScriptSuccessGauge.DeletePartialMatch(labels)
+		networkTargetScriptFailedStepGauge.DeletePartialMatch(labels)
+		networkTargetMutex.Unlock()
+
+		tlsMutex.Lock()
+		tlsHandshakeSuccessGauge.DeletePartialMatch(labels)
+		tlsCertNotAfterGauge.DeletePartialMatch(labels)
+		tlsCertVerifiedGauge.DeletePartialMatch(labels)
+		for _, previous := range []map[string]prometheus.Labels{tlsCertInfoLabels, tlsVersionLabels} {
+			for infoKey, infoLabels := range previous {
+				if containsLabels(infoLabels, labels) {
+					delete(previous, infoKey)
+				}
+			}
+		}
+		tlsCertInfoGauge.DeletePartialMatch(labels)
+		tlsVersionGauge.DeletePartialMatch(labels)
+		tlsMutex.Unlock()
+	}
+	networkTargetLabels = current
+}
+
+// labelsKey returns a key of the label set which does not depend on the
+// order of the labels
+func labelsKey(labels prometheus.Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + "=" + strconv.Quote(labels[name]) + ",")
+	}
+	return b.String()
+}
+
+// containsLabels checks that labels contain all labels of subset
+func containsLabels(labels prometheus.Labels, subset prometheus.Labels) bool {
+	for name, value := range subset {
+		if v, exists := labels[name]; !exists || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+func updateNetworkTargetPhaseMetrics(targetLabels prometheus.Labels, phase string, duration time.Duration) {
+	labels := copyLabels(targetLabels)
+	labels["phase"] = phase
+
+	networkTargetMutex.Lock()
+	defer networkTargetMutex.Unlock()
+	if duration == 0 {
+		// the histogram keeps the observations of earlier cycles
+		networkTargetPhaseDurationGauge.Delete(labels)
+		return
+	}
+	networkTargetPhaseDurationGauge.With(labels).Set(duration.Seconds())
+	networkTargetPhaseDurationHistogram.With(labels).Observe(duration.Seconds())
+}
+
+func updateHTTPProbeMetrics(t network.ResultTarget) {
+	r := t.HTTP
+	labels := targetLabels(t, prometheus.Labels{
+		"url":    r.URL,
+		"method": r.Method,
+	})
+	success := 0
+	if r.Success {
+		success = 1
+	}
+
+	httpProbeMutex.Lock()
+	defer httpProbeMutex.Unlock()
+	httpProbeSuccessGauge.With(labels).Set(float64(success))
+	httpProbeStatusCodeGauge.With(labels).Set(float64(r.StatusCode))
+	httpProbeDurationGauge.With(labels).Set(r.Duration.Seconds())
+	httpProbeContentLengthGauge.With(labels).Set(float64(r.ContentLength))
+}
+
+func updateDNSProbeMetrics(t network.ResultTarget) {
+	r := t.DNS
+	labels := targetLabels(t, prometheus.Labels{
+		"query":  r.Query,
+		"type":   r.QueryType,
+		"server": r.Server,
+	})
+	success := 0
+	if r.Success {
+		success = 1
+	}
+
+	dnsProbeMutex.Lock()
+	defer dnsProbeMutex.Unlock()
+	dnsProbeSuccessGauge.With(labels).Set(float64(success))
+	dnsProbeDurationGauge.With(labels).Set(r.Duration.Seconds())
+	dnsProbeAnswersGauge.With(labels).Set(float64(r.AnswerCount))
+	dnsProbeRcodeGauge.With(labels).Set(float64(r.Rcode))
+}
+
+func updateICMPProbeMetrics(t network.ResultTarget) {
+	r := t.ICMP
+	labels := targetLabels(t, prometheus.Labels{
+		"host": r.Host,
+		"ip":   r.IP,
+	})
+	success := 0
+	if r.Received > 0 {
+		success = 1
+	}
+
+	icmpProbeMutex.Lock()
+	defer icmpProbeMutex.Unlock()
+	icmpProbeSuccessGauge.With(labels).Set(float64(success))
+	icmpProbeLossRatioGauge.With(labels).Set(r.LossRatio)
+	if r.Received > 0 {
+		icmpProbeRTTMinGauge.With(labels).Set(r.MinRTT.Seconds())
+		icmpProbeRTTAvgGauge.With(labels).Set(r.AvgRTT.Seconds())
+		icmpProbeRTTMaxGauge.With(labels).Set(r.MaxRTT.Seconds())
+		icmpProbeJitterGauge.With(labels).Set(r.Jitter.Seconds())
+	} else {
+		// round trip times of an earlier cycle would look current
+		icmpProbeRTTMinGauge.Delete(labels)
+		icmpProbeRTTAvgGauge.Delete(labels)
+		icmpProbeRTTMaxGauge.Delete(labels)
+		icmpProbeJitterGauge.Delete(labels)
+	}
+}
+
+func updateTLSMetrics(targetLabels prometheus.Labels, r *network.TLSResult) {
+	tlsMutex.Lock()
+	defer tlsMutex.Unlock()
+
+	labels := copyLabels(targetLabels)
+	labels["server_name"] = r.ServerName
+	key := labels["name"] + ":" + labels["host"] + ":" + labels["port"] + ":" + labels["ip"] + ":" + r.ServerName
+
+	if !r.HandshakeOK {
+		// certificate series of an earlier handshake would look current
+		tlsHandshakeSuccessGauge.With(labels).Set(0)
+		tlsCertNotAfterGauge.Delete(labels)
+		tlsCertVerifiedGauge.Delete(labels)
+		deleteInfoMetric(tlsCertInfoGauge, tlsCertInfoLabels, key)
+		deleteInfoMetric(tlsVersionGauge, tlsVersionLabels, key)
+		return
+	}
+	tlsHandshakeSuccessGauge.With(labels).Set(1)
+	tlsCertNotAfterGauge.With(labels).Set(float64(r.NotAfter.Unix()))
+
+	verified := 0
+	if r.Verified {
+		verified = 1
+	}
+	tlsCertVerifiedGauge.With(labels).Set(float64(verified))
+
+	certLabels := copyLabels(labels)
+	certLabels["subject"] = r.Subject
+	certLabels["issuer"] = r.Issuer
+	certLabels["dns_names"] = strings.Join(r.DNSNames, ",")
+	certLabels["serial"] = r.SerialNumber
+	setInfoMetric(tlsCertInfoGauge, tlsCertInfoLabels, key, certLabels)
+
+	versionLabels := copyLabels(labels)
+	versionLabels["version"] = r.Version
+	setInfoMetric(tlsVersionGauge, tlsVersionLabels, key, versionLabels)
+}
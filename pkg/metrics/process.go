@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/orangeAppsRu/custom-exporter/pkg/proc"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	processGroupCountGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_count",
+			Help: "Number of processes matching the process filter",
+		},
+		[]string{"process"},
+	)
+
+	processGroupThreadsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_threads",
+			Help: "Number of threads of processes",
+		},
+		[]string{"process"},
+	)
+
+	processGroupOpenFDsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_fds_open",
+			Help: "Number of open file descriptors of processes",
+		},
+		[]string{"process"},
+	)
+
+	processGroupFDsUsageRatioGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_max_fds_usage_ratio",
+			Help: "Highest ratio of open file descriptors to RLIMIT_NOFILE of a single process",
+		},
+		[]string{"process"},
+	)
+
+	processGroupOldestStartTimeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_oldest_start_time_seconds",
+			Help: "Start time of the oldest process in seconds since the epoch",
+		},
+		[]string{"process"},
+	)
+
+	processGroupNewestStartTimeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_newest_start_time_seconds",
+			Help: "Start time of the newest process in seconds since the epoch",
+		},
+		[]string{"process"},
+	)
+
+	processGroupRestartsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "process_restarts_total",
+			Help: "Number of processes started since the previous scan, detected by PID and start time changes",
+		},
+		[]string{"process"},
+	)
+
+	processCountWithinExpectedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_count_within_expected",
+			Help: "Number of matching processes is within the configured min and max (1) or not (0)",
+		},
+		[]string{"process"},
+	)
+
+	processMemoryPSSGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_memory_pss",
+			Help: "Proportional set size of processes in bytes, shared pages are divided between the processes sharing them",
+		},
+		[]string{"process"},
+	)
+
+	processMemoryUSSGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_memory_uss",
+			Help: "Unique set size (private memory) of processes in bytes",
+		},
+		[]string{"process"},
+	)
+
+	processMemorySharedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_memory_shared",
+			Help: "Shared memory of processes in bytes, counted once per process",
+		},
+		[]string{"process"},
+	)
+
+	processMemorySwapGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_memory_swap",
+			Help: "Swapped out anonymous memory of processes in bytes",
+		},
+		[]string{"process"},
+	)
+
+	processGroupMutex sync.Mutex
+)
+
+// UpdateProcessGroupMetrics exports the resource usage of the processes
+// matching a process filter
+func UpdateProcessGroupMetrics(process string, usage proc.ProcessUsage) {
+	procCollector.Update("cpu_time", process, usage.CPUTime)
+	procCollector.Update("cpu_user_time", process, usage.UserCPUTime)
+	procCollector.Update("cpu_system_time", process, usage.SystemCPUTime)
+	procCollector.Update("io_read_bytes", process, float64(usage.ReadBytes))
+	procCollector.Update("io_write_bytes", process, float64(usage.WriteBytes))
+	procCollector.Update("voluntary_ctx_switches", process, float64(usage.VoluntaryCtxSwitches))
+	procCollector.Update("involuntary_ctx_switches", process, float64(usage.InvoluntaryCtxSwitches))
+	procCollector.Update("major_faults", process, float64(usage.MajorFaults))
+	UpdateProcessMemoryResidentMetrics(process, usage.ResidentMemory)
+
+	processGroupMutex.Lock()
+	defer processGroupMutex.Unlock()
+	processGroupCountGauge.WithLabelValues(process).Set(float64(usage.Count))
+	processGroupThreadsGauge.WithLabelValues(process).Set(float64(usage.Threads))
+	processGroupOpenFDsGauge.WithLabelValues(process).Set(float64(usage.OpenFDs))
+	processGroupFDsUsageRatioGauge.WithLabelValues(process).Set(usage.MaxFDsUsageRatio)
+
+	// start times are not exported while no process is running
+	if usage.Count == 0 {
+		processGroupOldestStartTimeGauge.DeleteLabelValues(process)
+		processGroupNewestStartTimeGauge.DeleteLabelValues(process)
+	} else {
+		processGroupOldestStartTimeGauge.WithLabelValues(process).Set(usage.OldestStartTime)
+		processGroupNewestStartTimeGauge.WithLabelValues(process).Set(usage.NewestStartTime)
+	}
+}
+
+func AddProcessRestarts(process string, count int) {
+	processGroupRestartsCounter.WithLabelValues(process).Add(float64(count))
+}
+
+func UpdateProcessCountWithinExpectedMetrics(process string, within bool) {
+	value := 0.0
+	if within {
+		value = 1
+	}
+	processGroupMutex.Lock()
+	processCountWithinExpectedGauge.WithLabelValues(process).Set(value)
+	processGroupMutex.Unlock()
+}
+
+func UpdateProcessMemoryMetrics(process string, memory proc.ProcessMemory) {
+	processGroupMutex.Lock()
+	defer processGroupMutex.Unlock()
+	processMemoryPSSGauge.WithLabelValues(process).Set(float64(memory.PSS))
+	processMemoryUSSGauge.WithLabelValues(process).Set(float64(memory.USS))
+	processMemorySharedGauge.WithLabelValues(process).Set(float64(memory.Shared))
+	processMemorySwapGauge.WithLabelValues(process).Set(float64(memory.Swap))
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/orangeAppsRu/custom-exporter/pkg/proc"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// cmdline label is truncated to keep series readable
+	maxCmdlineLabelLength = 64
+)
+
+var (
+	processPidCollector = NewProcessPidCollector()
+)
+
+// ProcessPidCollector exports per-PID series of process filters with perPid,
+// samples of a filter are replaced every cycle so series of exited processes
+// disappear with the next scan
+type ProcessPidCollector struct {
+	cpuTime        *prometheus.Desc
+	residentMemory *prometheus.Desc
+	threads        *prometheus.Desc
+	startTime      *prometheus.Desc
+	samples        map[string][]proc.ProcessSample
+	mu             sync.Mutex
+}
+
+func NewProcessPidCollector() *ProcessPidCollector {
+	labels := []string{"process", "pid", "cmdline"}
+	return &ProcessPidCollector{
+		cpuTime: prometheus.NewDesc(
+			"process_pid_cpu_time_total",
+			"CPU time consumed by the process in seconds",
+			labels,
+			nil,
+		),
+		residentMemory: prometheus.NewDesc(
+			"process_pid_memory_resident",
+			"Resident memory of the process in bytes",
+			labels,
+			nil,
+		),
+		threads: prometheus.NewDesc(
+			"process_pid_threads",
+			"Number of threads of the process",
+			labels,
+			nil,
+		),
+		startTime: prometheus.NewDesc(
+			"process_pid_start_time_seconds",
+			"Start time of the process in seconds since the epoch",
+			labels,
+			nil,
+		),
+		samples: make(map[string][]proc.ProcessSample),
+	}
+}
+
+func (c *ProcessPidCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.cpuTime
+	ch <- c.residentMemory
+	ch <- c.threads
+	ch <- c.startTime
+}
+
+func (c *ProcessPidCollector) Update(process string, samples []proc.ProcessSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples[process] = samples
+}
+
+func (c *ProcessPidCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for process, samples := range c.samples {
+		for _, s := range samples {
+			// replaced before truncating so the truncated label has full characters
+			cmdline := truncateLabel(validLabelValue(s.Cmdline), maxCmdlineLabelLength)
+			labels := []string{process, strconv.Itoa(s.PID), cmdline}
+			sendConstMetric(ch, c.cpuTime, prometheus.CounterValue, s.CPUTime, labels...)
+			sendConstMetric(ch, c.residentMemory, prometheus.GaugeValue, float64(s.ResidentMemory), labels...)
+			sendConstMetric(ch, c.threads, prometheus.GaugeValue, float64(s.Threads), labels...)
+			sendConstMetric(ch, c.startTime, prometheus.GaugeValue, s.StartTime, labels...)
+		}
+	}
+}
+
+func GetProcessPidCollector() *ProcessPidCollector {
+	return processPidCollector
+}
+
+func truncateLabel(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+	return string(runes[:length])
+}
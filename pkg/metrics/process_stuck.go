@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/orangeAppsRu/custom-exporter/pkg/proc"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	processStuckCollector = NewProcessStuckCollector()
+)
+
+// ProcessStuckCollector exports zombie and D-state processes of the last
+// cycle, series of parents without stuck processes disappear
+type ProcessStuckCollector struct {
+	count     *prometheus.Desc
+	oldestAge *prometheus.Desc
+	wchan     *prometheus.Desc
+	stuck     proc.StuckProcesses
+	mu        sync.Mutex
+}
+
+func NewProcessStuckCollector() *ProcessStuckCollector {
+	return &ProcessStuckCollector{
+		count: prometheus.NewDesc(
+			"process_stuck_count",
+			"Number of zombie and uninterruptible sleep processes by parent process name",
+			[]string{"state", "parent"},
+			nil,
+		),
+		oldestAge: prometheus.NewDesc(
+			"process_stuck_oldest_age_seconds",
+			"Longest time a zombie or uninterruptible sleep process has been observed in the state",
+			[]string{"state", "parent"},
+			nil,
+		),
+		wchan: prometheus.NewDesc(
+			"process_uninterruptible_sleep_wchan_count",
+			"Number of uninterruptible sleep processes by kernel function they are waiting in",
+			[]string{"wchan"},
+			nil,
+		),
+	}
+}
+
+func (c *ProcessStuckCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.count
+	ch <- c.oldestAge
+	ch <- c.wchan
+}
+
+func (c *ProcessStuckCollector) Update(stuck proc.StuckProcesses) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stuck = stuck
+}
+
+func (c *ProcessStuckCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// groups are merged by valid label values, parent names differing only
+	// in invalid bytes would be duplicate series
+	groups := make(map[[2]string]proc.StuckGroup)
+	for _, g := range c.stuck.Groups {
+		key := [2]string{g.State, validLabelValue(g.ParentComm)}
+		group := groups[key]
+		group.Count += g.Count
+		group.OldestAge = max(group.OldestAge, g.OldestAge)
+		groups[key] = group
+	}
+	for key, g := range groups {
+		sendConstMetric(ch, c.count, prometheus.GaugeValue, float64(g.Count), key[0], key[1])
+		sendConstMetric(ch, c.oldestAge, prometheus.GaugeValue, g.OldestAge.Seconds(), key[0], key[1])
+	}
+	for wchan, count := range c.stuck.Wchan {
+		sendConstMetric(ch, c.wchan, prometheus.GaugeValue, float64(count), wchan)
+	}
+}
+
+func GetProcessStuckCollector() *ProcessStuckCollector {
+	return processStuckCollector
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/orangeAppsRu/custom-exporter/pkg/proc"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	processTopCollector = NewProcessTopCollector()
+)
+
+// ProcessTopCollector exports the top processes of the last cycle, series of
+// processes which left the top disappear with the next cycle
+type ProcessTopCollector struct {
+	cpuUsage       *prometheus.Desc
+	residentMemory *prometheus.Desc
+	topCPU         []proc.TopProcess
+	topMemory      []proc.TopProcess
+	mu             sync.Mutex
+}
+
+func NewProcessTopCollector() *ProcessTopCollector {
+	labels := []string{"comm", "user", "pid"}
+	return &ProcessTopCollector{
+		cpuUsage: prometheus.NewDesc(
+			"process_top_cpu_usage",
+			"CPU seconds per second used since the previous scan by the processes with the highest CPU usage",
+			labels,
+			nil,
+		),
+		residentMemory: prometheus.NewDesc(
+			"process_top_memory_resident",
+			"Resident memory in bytes of the processes with the highest resident memory",
+			labels,
+			nil,
+		),
+	}
+}
+
+func (c *ProcessTopCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.cpuUsage
+	ch <- c.residentMemory
+}
+
+func (c *ProcessTopCollector) Update(topCPU []proc.TopProcess, topMemory []proc.TopProcess) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.topCPU = topCPU
+	c.topMemory = topMemory
+}
+
+func (c *ProcessTopCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range c.topCPU {
+		sendConstMetric(ch, c.cpuUsage, prometheus.GaugeValue, p.CPUUsage, p.Comm, p.User, strconv.Itoa(p.PID))
+	}
+	for _, p := range c.topMemory {
+		sendConstMetric(ch, c.residentMemory, prometheus.GaugeValue, float64(p.ResidentMemory), p.Comm, p.User, strconv.Itoa(p.PID))
+	}
+}
+
+func GetProcessTopCollector() *ProcessTopCollector {
+	return processTopCollector
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/orangeAppsRu/custom-exporter/pkg/sockets"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	listeningSocketInfoGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "listening_socket_info",
+			Help: "Listening TCP socket or unconnected UDP socket of the host",
+		},
+		[]string{"addr", "port", "proto", "process"},
+	)
+
+	listeningSocketUnexpectedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "listening_socket_unexpected",
+			Help: "Listening socket which does not match any expected listener",
+		},
+		[]string{"addr", "port", "proto", "process"},
+	)
+
+	listeningSocketExpectedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "listening_socket_expected_up",
+			Help: "Expected listener is present (1) or missing (0)",
+		},
+		[]string{"addr", "port", "proto", "process"},
+	)
+
+	// series exported in the previous cycle, removed if the socket is gone
+	listeningSocketInfoLabels       = make(map[string]prometheus.Labels)
+	listeningSocketUnexpectedLabels = make(map[string]prometheus.Labels)
+
+	listeningSocketMutex sync.Mutex
+)
+
+func listenerLabels(l sockets.Listener) prometheus.Labels {
+	return prometheus.Labels{
+		"addr":    l.Addr,
+		"port":    strconv.Itoa(int(l.Port)),
+		"proto":   l.Proto,
+		"process": l.Process,
+	}
+}
+
+// setListenerMetrics sets series for the listeners and deletes series of
+// listeners which are not present anymore
+func setListenerMetrics(gauge *prometheus.GaugeVec, previous map[string]prometheus.Labels, listeners []sockets.Listener) {
+	current := make(map[string]prometheus.Labels)
+	for _, l := range listeners {
+		labels := listenerLabels(l)
+		gaugeWith(gauge, labels).Set(1)
+		key := labels["proto"] + "|" + labels["addr"] + "|" + labels["port"] + "|" + labels["process"]
+		current[key] = labels
+	}
+	for key, labels := range previous {
+		if _, exists := current[key]; !exists {
+			gauge.Delete(labels)
+			delete(previous, key)
+		}
+	}
+	for key, labels := range current {
+		previous[key] = labels
+	}
+}
+
+func UpdateListeningSocketsMetrics(listeners []sockets.Listener, expected []sockets.ExpectedListenerResult, unexpected []sockets.Listener) {
+	listeningSocketMutex.Lock()
+	defer listeningSocketMutex.Unlock()
+
+	setListenerMetrics(listeningSocketInfoGauge, listeningSocketInfoLabels, listeners)
+	setListenerMetrics(listeningSocketUnexpectedGauge, listeningSocketUnexpectedLabels, unexpected)
+
+	for _, e := range expected {
+		value := 0.0
+		if e.Found {
+			value = 1
+		}
+		listeningSocketExpectedGauge.With(prometheus.Labels{
+			"addr":    e.Addr,
+			"port":    strconv.Itoa(int(e.Port)),
+			"proto":   e.Proto,
+			"process": e.Process,
+		}).Set(value)
+	}
+}
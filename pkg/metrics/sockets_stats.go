@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/orangeAppsRu/custom-exporter/pkg/sockets"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	tcpConnectionsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tcp_connections",
+			Help: "Number of TCP sockets by state",
+		},
+		[]string{"state"},
+	)
+
+	tcpConnectionsByLocalPortGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tcp_connections_by_local_port",
+			Help: "Number of TCP sockets by state for configured local ports",
+		},
+		[]string{"state", "port"},
+	)
+
+	tcpConnectionsByRemotePortGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tcp_connections_by_remote_port",
+			Help: "Number of TCP sockets by state for configured remote ports",
+		},
+		[]string{"state", "port"},
+	)
+
+	sockstatGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sockstat",
+			Help: "Socket usage from /proc/net/sockstat and /proc/net/sockstat6, mem and memory are in pages",
+		},
+		[]string{"protocol", "type"},
+	)
+
+	// registered by the first update, hosts without conntrack have no series
+	conntrackEntriesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "conntrack_entries",
+			Help: "Number of entries in the conntrack table",
+		},
+	)
+
+	conntrackEntriesLimitGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "conntrack_entries_limit",
+			Help: "Maximum size of the conntrack table",
+		},
+	)
+
+	registerConntrackOnce sync.Once
+
+	socketStatsMutex sync.Mutex
+)
+
+func UpdateTCPStatsMetrics(stats sockets.TCPStats) {
+	socketStatsMutex.Lock()
+	defer socketStatsMutex.Unlock()
+
+	for state, count := range stats.States {
+		tcpConnectionsGauge.WithLabelValues(state).Set(float64(count))
+	}
+	for port, states := range stats.LocalPorts {
+		for state, count := range states {
+			tcpConnectionsByLocalPortGauge.WithLabelValues(state, strconv.Itoa(int(port))).Set(float64(count))
+		}
+	}
+	for port, states := range stats.RemotePorts {
+		for state, count := range states {
+			tcpConnectionsByRemotePortGauge.WithLabelValues(state, strconv.Itoa(int(port))).Set(float64(count))
+		}
+	}
+}
+
+func UpdateSockstatMetrics(values []sockets.SockstatValue) {
+	socketStatsMutex.Lock()
+	defer socketStatsMutex.Unlock()
+
+	for _, v := range values {
+		sockstatGauge.WithLabelValues(v.Protocol, v.Type).Set(float64(v.Value))
+	}
+}
+
+func UpdateConntrackMetrics(conntrack *sockets.Conntrack) {
+	socketStatsMutex.Lock()
+	defer socketStatsMutex.Unlock()
+
+	registerConntrackOnce.Do(func() {
+		prometheus.MustRegister(conntrackEntriesGauge)
+		prometheus.MustRegister(conntrackEntriesLimitGauge)
+	})
+	conntrackEntriesGauge.Set(float64(conntrack.Count))
+	conntrackEntriesLimitGauge.Set(float64(conntrack.Max))
+}
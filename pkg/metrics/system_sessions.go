@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/orangeAppsRu/custom-exporter/pkg/system"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	loginSessionsCollector = NewLoginSessionsCollector()
+)
+
+// LoginSessionsCollector exports login sessions from utmp, series of users,
+// terminals and hosts without sessions disappear with the next cycle
+type LoginSessionsCollector struct {
+	byUser    *prometheus.Desc
+	byTTYType *prometheus.Desc
+	byHost    *prometheus.Desc
+	oldestAge *prometheus.Desc
+	sessions  []system.LoginSession
+	mu        sync.Mutex
+}
+
+func NewLoginSessionsCollector() *LoginSessionsCollector {
+	return &LoginSessionsCollector{
+		byUser: prometheus.NewDesc(
+			"login_sessions_by_user",
+			"Number of login sessions by user",
+			[]string{"user"},
+			nil,
+		),
+		byTTYType: prometheus.NewDesc(
+			"login_sessions_by_tty_type",
+			"Number of login sessions by terminal type (pts, tty, console, other)",
+			[]string{"type"},
+			nil,
+		),
+		byHost: prometheus.NewDesc(
+			"login_sessions_by_host",
+			"Number of login sessions by remote host, local for local sessions",
+			[]string{"host"},
+			nil,
+		),
+		oldestAge: prometheus.NewDesc(
+			"login_session_oldest_age_seconds",
+			"Age of the oldest login session in seconds",
+			nil,
+			nil,
+		),
+	}
+}
+
+func (c *LoginSessionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.byUser
+	ch <- c.byTTYType
+	ch <- c.byHost
+	ch <- c.oldestAge
+}
+
+func (c *LoginSessionsCollector) Update(sessions []system.LoginSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sessions = sessions
+}
+
+func (c *LoginSessionsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	byUser := make(map[string]int)
+	byTTYType := make(map[string]int)
+	byHost := make(map[string]int)
+	var oldest time.Time
+	// counted by valid label values, names differing only in invalid bytes
+	// would be duplicate series
+	for _, s := range c.sessions {
+		byUser[validLabelValue(s.User)]++
+		byTTYType[s.TTYType()]++
+		host := validLabelValue(s.Host)
+		if host == "" {
+			host = "local"
+		}
+		byHost[host]++
+		if oldest.IsZero() || s.LoginTime.Before(oldest) {
+			oldest = s.LoginTime
+		}
+	}
+
+	for user, count := range byUser {
+		sendConstMetric(ch, c.byUser, prometheus.GaugeValue, float64(count), user)
+	}
+	for ttyType, count := range byTTYType {
+		sendConstMetric(ch, c.byTTYType, prometheus.GaugeValue, float64(count), ttyType)
+	}
+	for host, count := range byHost {
+		sendConstMetric(ch, c.byHost, prometheus.GaugeValue, float64(count), host)
+	}
+	oldestAge := 0.0
+	if !oldest.IsZero() {
+		oldestAge = time.Since(oldest).Seconds()
+	}
+	sendConstMetric(ch, c.oldestAge, prometheus.GaugeValue, oldestAge)
+}
+
+func GetLoginSessionsCollector() *LoginSessionsCollector {
+	return loginSessionsCollector
+}
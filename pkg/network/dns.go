@@ -0,0 +1,324 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	resolvConfPath = "/etc/resolv.conf"
+	// label value of the server for probes using nameservers from resolv.conf
+	systemResolver = "system"
+)
+
+var (
+	dnsQueryTypes = map[string]dnsmessage.Type{
+		"A":     dnsmessage.TypeA,
+		"AAAA":  dnsmessage.TypeAAAA,
+		"CNAME": dnsmessage.TypeCNAME,
+		"MX":    dnsmessage.TypeMX,
+		"NS":    dnsmessage.TypeNS,
+		"TXT":   dnsmessage.TypeTXT,
+		"SRV":   dnsmessage.TypeSRV,
+	}
+
+	dnsRcodes = map[dnsmessage.RCode]string{
+		dnsmessage.RCodeSuccess:        "NOERROR",
+		dnsmessage.RCodeFormatError:    "FORMERR",
+		dnsmessage.RCodeServerFailure:  "SERVFAIL",
+		dnsmessage.RCodeNameError:      "NXDOMAIN",
+		dnsmessage.RCodeNotImplemented: "NOTIMP",
+		dnsmessage.RCodeRefused:        "REFUSED",
+	}
+)
+
+type DNSResult struct {
+	Query       string
+	QueryType   string
+	Server      string
+	Success     bool
+	Rcode       int
+	Duration    time.Duration
+	AnswerCount int
+}
+
+func checkDNSTarget(t Target) ResultTarget {
+	queryType := strings.ToUpper(t.QueryType)
+	if queryType == "" {
+		queryType = "A"
+	}
+	server := t.Server
+	if server == "" {
+		server = systemResolver
+	}
+	result := ResultTarget{
+		Host:     t.Host,
+		Port:     t.Port,
+		Protocol: t.Protocol,
+		DNS: &DNSResult{
+			Query:     t.Query,
+			QueryType: queryType,
+			Server:    server,
+			Rcode:     -1,
+		},
+	}
+
+	var servers []string
+	if t.Server != "" {
+		servers = []string{withDefaultPort(t.Server, "53")}
+	} else {
+		nameservers, err := systemNameservers()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "checkDNSTarget: read nameservers, error: %s\n", err)
+			return result
+		}
+		servers = nameservers
+	}
+
+	timeout := targetTimeout(t, defaultTimeout)
+
+	start := time.Now()
+	var (
+		resp *dnsmessage.Message
+		err  error
+	)
+	// nameservers from resolv.conf are tried in order like the system resolver does
+	for _, s := range servers {
+		resp, err = dnsQuery(s, t.Query, t.queryType, timeout)
+		if err == nil {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "checkDNSTarget: query %s %s to server: %s, error: %s\n", queryType, t.Query, s, err)
+	}
+	result.DNS.Duration = time.Since(start)
+	if err != nil {
+		return result
+	}
+
+	result.DNS.Rcode = int(resp.Header.RCode)
+	result.DNS.AnswerCount = len(resp.Answers)
+
+	expectedRcode := strings.ToUpper(t.ExpectedRcode)
+	if expectedRcode == "" {
+		expectedRcode = "NOERROR"
+	}
+	if rcodeName(resp.Header.RCode) != expectedRcode {
+		fmt.Fprintf(os.Stderr, "checkDNSTarget: query %s %s returned rcode: %s, expected: %s\n", queryType, t.Query, rcodeName(resp.Header.RCode), expectedRcode)
+		return result
+	}
+
+	answers := make([]string, 0, len(resp.Answers))
+	for _, a := range resp.Answers {
+		answers = append(answers, formatDNSAnswer(a))
+	}
+	for _, expected := range t.expectedAnswers {
+		if !matchAnyAnswer(expected, answers) {
+			fmt.Fprintf(os.Stderr, "checkDNSTarget: query %s %s no answer matches: %s, answers: %v\n", queryType, t.Query, expected, answers)
+			return result
+		}
+	}
+
+	result.IsOpen = true
+	result.DNS.Success = true
+	return result
+}
+
+func dnsQuery(server string, name string, qtype dnsmessage.Type, timeout time.Duration) (*dnsmessage.Message, error) {
+	fqdn, err := dnsmessage.NewName(dnsFQDN(name))
+	if err != nil {
+		return nil, err
+	}
+	id := uint16(rand.Intn(1 << 16))
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               id,
+			RecursionDesired: true,
+		},
+		Questions: []dnsmessage.Question{{
+			Name:  fqdn,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := dnsExchange("udp", server, packed, timeout)
+	if err == nil && resp.Header.Truncated {
+		resp, err = dnsExchange("tcp", server, packed, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Header.ID != id {
+		return nil, fmt.Errorf("response id %d does not match query id %d", resp.Header.ID, id)
+	}
+	return resp, nil
+}
+
+func dnsExchange(network string, server string, query []byte, timeout time.Duration) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout(network, server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var buffer []byte
+	if network == "tcp" {
+		// DNS over TCP messages are prefixed with a two byte length
+		msg := make([]byte, 2, 2+len(query))
+		binary.BigEndian.PutUint16(msg, uint16(len(query)))
+		if _, err := conn.Write(append(msg, query...)); err != nil {
+			return nil, err
+		}
+		length := make([]byte, 2)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return nil, err
+		}
+		buffer = make([]byte, binary.BigEndian.Uint16(length))
+		if _, err := io.ReadFull(conn, buffer); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buffer = make([]byte, 65535)
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return nil, err
+		}
+		buffer = buffer[:n]
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buffer); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return &resp, nil
+}
+
+// systemNameservers returns nameservers from resolv.conf so a broken
+// resolver configuration of the host is detected
+func systemNameservers() ([]string, error) {
+	f, err := os.Open(resolvConfPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			// the zone of link local addresses like fe80::1%eth0 is kept,
+			// JoinHostPort brackets it together with the address
+			servers = append(servers, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no nameservers in %s", resolvConfPath)
+	}
+	return servers, nil
+}
+
+func withDefaultPort(address string, port string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(strings.Trim(address, "[]"), port)
+}
+
+func dnsFQDN(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func rcodeName(rcode dnsmessage.RCode) string {
+	if name, ok := dnsRcodes[rcode]; ok {
+		return name
+	}
+	return rcode.String()
+}
+
+func formatDNSAnswer(r dnsmessage.Resource) string {
+	switch body := r.Body.(type) {
+	case *dnsmessage.AResource:
+		return net.IP(body.A[:]).String()
+	case *dnsmessage.AAAAResource:
+		return net.IP(body.AAAA[:]).String()
+	case *dnsmessage.CNAMEResource:
+		return body.CNAME.String()
+	case *dnsmessage.NSResource:
+		return body.NS.String()
+	case *dnsmessage.MXResource:
+		return fmt.Sprintf("%d %s", body.Pref, body.MX.String())
+	case *dnsmessage.TXTResource:
+		return strings.Join(body.TXT, "")
+	case *dnsmessage.SRVResource:
+		return fmt.Sprintf("%d %d %d %s", body.Priority, body.Weight, body.Port, body.Target.String())
+	}
+	return r.Body.GoString()
+}
+
+func matchAnyAnswer(expected *regexp.Regexp, answers []string) bool {
+	for _, a := range answers {
+		if expected.MatchString(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileDNSTarget checks the query type and the expected rcode and compiles
+// the expected answer regexes of the target
+func compileDNSTarget(t *Target) error {
+	queryType := strings.ToUpper(t.QueryType)
+	if queryType == "" {
+		queryType = "A"
+	}
+	qtype, ok := dnsQueryTypes[queryType]
+	if !ok {
+		return fmt.Errorf("unsupported queryType: %q", t.QueryType)
+	}
+	t.queryType = qtype
+
+	if rcode := strings.ToUpper(t.ExpectedRcode); rcode != "" {
+		known := false
+		for _, name := range dnsRcodes {
+			known = known || name == rcode
+		}
+		if !known {
+			return fmt.Errorf("unknown expectedRcode: %q", t.ExpectedRcode)
+		}
+	}
+
+	t.expectedAnswers = nil
+	for _, expected := range t.ExpectedAnswers {
+		re, err := regexp.Compile(expected)
+		if err != nil {
+			return fmt.Errorf("invalid expectedAnswers regex %q: %v", expected, err)
+		}
+		t.expectedAnswers = append(t.expectedAnswers, re)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package network
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHTTPMaxRedirects = 10
+	// limit of the response body read for the body regex and the content length
+	maxHTTPBodySize = 10 * 1024 * 1024
+)
+
+type HTTPResult struct {
+	URL           string
+	Method        string
+	Success       bool
+	StatusCode    int
+	Duration      time.Duration
+	ContentLength int64
+}
+
+func checkHTTPTarget(t Target) ResultTarget {
+	method := strings.ToUpper(t.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	result := ResultTarget{
+		Host:     t.Host,
+		Port:     t.Port,
+		Protocol: t.Protocol,
+		HTTP: &HTTPResult{
+			URL:    t.URL,
+			Method: method,
+		},
+	}
+
+	timeout := targetTimeout(t, defaultTimeout)
+	maxRedirects := t.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = defaultHTTPMaxRedirects
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: t.InsecureSkipVerify,
+			},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if t.NoFollowRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+
+	req, err := http.NewRequest(method, t.URL, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "checkHTTPTarget: create request to url: %s, error: %s\n", t.URL, err)
+		return result
+	}
+	for name, value := range t.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "checkHTTPTarget: request to url: %s, error: %s\n", t.URL, err)
+		return result
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBodySize))
+	result.HTTP.Duration = time.Since(start)
+	result.HTTP.StatusCode = resp.StatusCode
+	result.HTTP.ContentLength = int64(len(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "checkHTTPTarget: read response from url: %s, error: %s\n", t.URL, err)
+		return result
+	}
+
+	if !validStatusCode(resp.StatusCode, t.ValidStatusCodes) {
+		fmt.Fprintf(os.Stderr, "checkHTTPTarget: url: %s returned unexpected status code: %d\n", t.URL, resp.StatusCode)
+		return result
+	}
+
+	if t.bodyRegex != nil && !t.bodyRegex.Match(body) {
+		fmt.Fprintf(os.Stderr, "checkHTTPTarget: response body of url: %s does not match regex: %s\n", t.URL, t.BodyRegex)
+		return result
+	}
+
+	result.IsOpen = true
+	result.HTTP.Success = true
+	return result
+}
+
+// compileHTTPTarget checks the url and compiles the body regex of the target
+func compileHTTPTarget(t *Target) error {
+	if t.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url: %q, expected http:// or https:// with a host", t.URL)
+	}
+
+	if t.BodyRegex == "" {
+		return nil
+	}
+	re, err := regexp.Compile(t.BodyRegex)
+	if err != nil {
+		return fmt.Errorf("invalid bodyRegex: %v", err)
+	}
+	t.bodyRegex = re
+	return nil
+}
+
+// validStatusCode accepts any 2xx status if no status codes are configured
+func validStatusCode(code int, validCodes []int) bool {
+	if len(validCodes) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, c := range validCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	defaultICMPCount    = 3
+	defaultICMPInterval = 1 * time.Second
+	defaultICMPTimeout  = 2 * time.Second
+
+	protocolICMP   = 1
+	protocolICMPv6 = 58
+)
+
+type ICMPResult struct {
+	Host      string
+	IP        string
+	Sent      int
+	Received  int
+	LossRatio float64
+	MinRTT    time.Duration
+	AvgRTT    time.Duration
+	MaxRTT    time.Duration
+	Jitter    time.Duration
+}
+
+func checkICMPTarget(t Target) ResultTarget {
+	result := ResultTarget{
+		Host:     t.Host,
+		Port:     t.Port,
+		Protocol: t.Protocol,
+		ICMP: &ICMPResult{
+			Host:      t.Host,
+			LossRatio: 1,
+		},
+	}
+
+	count := t.Count
+	if count <= 0 {
+		count = defaultICMPCount
+	}
+	interval := t.Interval
+	if interval == 0 {
+		interval = defaultICMPInterval
+	}
+	timeout := targetTimeout(t, defaultICMPTimeout)
+
+	ips, err := resolveTarget(t, timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "checkICMPTarget: resolve host: %s, error: %s\n", t.Host, err)
+		return result
+	}
+	result.ICMP.IP = ips[0].String()
+
+	rtts, err := ping(ips[0], count, interval, timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "checkICMPTarget: ping host: %s, error: %s\n", t.Host, err)
+		return result
+	}
+
+	result.ICMP.Sent = count
+	result.ICMP.Received = len(rtts)
+	result.ICMP.LossRatio = float64(count-len(rtts)) / float64(count)
+	if len(rtts) > 0 {
+		result.IsOpen = true
+		result.ICMP.MinRTT, result.ICMP.AvgRTT, result.ICMP.MaxRTT, result.ICMP.Jitter = rttStats(rtts)
+	}
+	return result
+}
+
+// listenICMP prefers unprivileged ICMP datagram sockets (net.ipv4.ping_group_range)
+// and falls back to raw sockets which require CAP_NET_RAW
+func listenICMP(isIPv6 bool) (*icmp.PacketConn, bool, error) {
+	network, rawNetwork, address := "udp4", "ip4:icmp", "0.0.0.0"
+	if isIPv6 {
+		network, rawNetwork, address = "udp6", "ip6:ipv6-icmp", "::"
+	}
+
+	conn, err := icmp.ListenPacket(network, address)
+	if err == nil {
+		return conn, false, nil
+	}
+	conn, rawErr := icmp.ListenPacket(rawNetwork, address)
+	if rawErr != nil {
+		return nil, false, fmt.Errorf("datagram socket: %v, raw socket: %v", err, rawErr)
+	}
+	return conn, true, nil
+}
+
+// ping sends count echo requests one after another and returns round trip
+// times of the received replies
+func ping(ip net.IP, count int, interval time.Duration, timeout time.Duration) ([]time.Duration, error) {
+	isIPv6 := ip.To4() == nil
+	conn, raw, err := listenICMP(isIPv6)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var (
+		dst         net.Addr  = &net.UDPAddr{IP: ip}
+		requestType icmp.Type = ipv4.ICMPTypeEcho
+		replyType   icmp.Type = ipv4.ICMPTypeEchoReply
+		protocol              = protocolICMP
+	)
+	if raw {
+		dst = &net.IPAddr{IP: ip}
+	}
+	if isIPv6 {
+		requestType, replyType, protocol = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply, protocolICMPv6
+	}
+
+	id := rand.Intn(0xffff)
+	var rtts []time.Duration
+	buffer := make([]byte, 1500)
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			time.Sleep(interval)
+		}
+
+		msg := icmp.Message{
+			Type: requestType,
+			Body: &icmp.Echo{
+				ID:   id,
+				Seq:  seq,
+				Data: []byte("custom-exporter"),
+			},
+		}
+		packet, err := msg.Marshal(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		if _, err := conn.WriteTo(packet, dst); err != nil {
+			return nil, err
+		}
+
+		deadline := start.Add(timeout)
+		conn.SetReadDeadline(deadline)
+		for time.Now().Before(deadline) {
+			n, peer, err := conn.ReadFrom(buffer)
+			if err != nil {
+				// timeout, the packet is lost
+				break
+			}
+			reply, err := icmp.ParseMessage(protocol, buffer[:n])
+			if err != nil || reply.Type != replyType {
+				continue
+			}
+			echo, ok := reply.Body.(*icmp.Echo)
+			if !ok || echo.Seq != seq {
+				continue
+			}
+			// the kernel replaces the id of datagram sockets with the local port
+			// and delivers only own replies, raw sockets receive all ICMP traffic
+			if raw && (echo.ID != id || !peerIP(peer).Equal(ip)) {
+				continue
+			}
+			rtts = append(rtts, time.Since(start))
+			break
+		}
+	}
+	return rtts, nil
+}
+
+func peerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// rttStats returns min, avg and max of round trip times, jitter is the mean
+// difference between consecutive round trip times
+func rttStats(rtts []time.Duration) (time.Duration, time.Duration, time.Duration, time.Duration) {
+	minRTT, maxRTT := rtts[0], rtts[0]
+	var total, jitter time.Duration
+	for i, rtt := range rtts {
+		total += rtt
+		if rtt < minRTT {
+			minRTT = rtt
+		}
+		if rtt > maxRTT {
+			maxRTT = rtt
+		}
+		if i > 0 {
+			jitter += time.Duration(math.Abs(float64(rtt - rtts[i-1])))
+		}
+	}
+	avgRTT := total / time.Duration(len(rtts))
+	if len(rtts) > 1 {
+		jitter /= time.Duration(len(rtts) - 1)
+	}
+	return minRTT, avgRTT, maxRTT, jitter
+}
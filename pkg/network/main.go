@@ -1,106 +1,585 @@
 package network
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"golang.org/x/net/dns/dnsmessage"
     // "github.com/sirupsen/logrus"
 )
 
+const (
+    defaultTimeout = 5 * time.Second
+    defaultUDPTimeout = 2 * time.Second
+    defaultRetryInterval = 1 * time.Second
+    // delay before addresses of the other family are dialed in parallel (RFC 8305)
+    dialFallbackDelay = 300 * time.Millisecond
+    // minimal share of the timeout for a single address if enough time is left
+    minAddressDialTimeout = 2 * time.Second
+    DefaultMaxConcurrency = 32
+)
+
+var (
+    labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+    // label names used by the port collector metrics, custom labels must not override them;
+    // le and quantile are added by histograms and summaries, client_golang panics on them
+    reservedLabelNames = []string{
+        "host", "port", "protocol", "name", "group", "ip", "phase", "server_name", "subject",
+        "issuer", "dns_names", "serial", "version", "url", "method", "query", "type", "server",
+        "le", "quantile",
+    }
+
+    checkFuncs = map[string]func(Target) ResultTarget{
+        "TCP": checkTCPTarget,
+        "UDP": checkUDPTarget,
+        "HTTP": checkHTTPTarget,
+        "DNS": checkDNSTarget,
+        "ICMP": checkICMPTarget,
+    }
+)
+
 
 type Target struct {
     Host string `yaml:"host"`
     Port uint16 `yaml:"port"`
     Protocol string `yaml:"protocol"`
+
+    Name string `yaml:"name"`
+    Group string `yaml:"group"`
+    Labels map[string]string `yaml:"labels"`
+
+    // probe every address of the host instead of the first reachable one
+    ResolveAll bool `yaml:"resolveAll"`
+    // ip4 or ip6, addresses of this family are tried first
+    PreferredFamily string `yaml:"preferredFamily"`
+
+    // zero timeout and unset retries are replaced with defaults of the port
+    // collector, retries: 0 disables retries of the target
+    Timeout time.Duration `yaml:"timeout"`
+    Retries *int `yaml:"retries"`
+    RetryInterval *time.Duration `yaml:"retryInterval"`
+
+    // TLS settings, only used for TCP targets
+    TLS bool `yaml:"tls"`
+    ServerName string `yaml:"serverName"`
+    StartTLS string `yaml:"startTLS"`
+
+    // send/expect script run after connect (and TLS handshake) of TCP targets
+    Script []ScriptStep `yaml:"script"`
+
+    // UDP probe settings
+    Payload string `yaml:"payload"`
+    PayloadHex string `yaml:"payloadHex"`
+    Expect string `yaml:"expect"`
+    ExpectHex string `yaml:"expectHex"`
+
+    // builtin script of TCP targets or payload of UDP targets
+    Preset string `yaml:"preset"`
+
+    // HTTP probe settings
+    URL string `yaml:"url"`
+    Method string `yaml:"method"`
+    Headers map[string]string `yaml:"headers"`
+    ValidStatusCodes []int `yaml:"validStatusCodes"`
+    BodyRegex string `yaml:"bodyRegex"`
+    NoFollowRedirects bool `yaml:"noFollowRedirects"`
+    MaxRedirects int `yaml:"maxRedirects"`
+    InsecureSkipVerify bool `yaml:"insecureSkipVerify"`
+
+    // DNS probe settings
+    Query string `yaml:"query"`
+    QueryType string `yaml:"queryType"`
+    Server string `yaml:"server"`
+    ExpectedRcode string `yaml:"expectedRcode"`
+    ExpectedAnswers []string `yaml:"expectedAnswers"`
+
+    // ICMP probe settings
+    Count int `yaml:"count"`
+    Interval time.Duration `yaml:"interval"`
+
+    // address to probe, set for each address of targets with resolveAll
+    ip net.IP
+
+    // compiled by ValidateTargets
+    bodyRegex *regexp.Regexp
+    queryType dnsmessage.Type
+    expectedAnswers []*regexp.Regexp
+    payload []byte
+    expectHex []byte
+    expect *regexp.Regexp
 }
 
 type ResultTarget struct {
     Host string 
     Port uint16
     Protocol string
+    Name string
+    Group string
+    Labels map[string]string
+    // probed address, only set for targets with resolveAll
+    IP string
     IsOpen bool
+    // the host refused the connection (TCP reset or ICMP port unreachable for UDP)
+    // as opposed to not answering at all
+    Closed bool
+
+    // duration of the probe phases, zero if the phase was not reached
+    ResolveDuration time.Duration
+    ConnectDuration time.Duration
+    TLSDuration time.Duration
+
+    TLS *TLSResult
+    Script *ScriptResult
+    HTTP *HTTPResult
+    DNS *DNSResult
+    ICMP *ICMPResult
 }
 
-func checkTCPTarget(t Target, results chan <- ResultTarget, wg *sync.WaitGroup) {
-    defer wg.Done()
+// resolveHost returns addresses of the host, IP literals are returned as is
+func resolveHost(host string, timeout time.Duration) ([]net.IP, error) {
+    if ip := net.ParseIP(host); ip != nil {
+        return []net.IP{ip}, nil
+    }
 
-    address := fmt.Sprintf("%s:%d", t.Host, t.Port)
-    conn, err := net.DialTimeout("tcp", address, time.Second * 5)
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
     if err != nil {
-        fmt.Fprintf(os.Stderr, "checkTCPTarget: try connect to host: %s, error: %s\n", address, err)
-        results <- ResultTarget{
-            Host: t.Host, 
-            Port: t.Port,
-            Protocol: t.Protocol,
-            IsOpen: false,
-        }
-        return
+        return nil, err
     }
-    defer conn.Close()
-    results <- ResultTarget{
+    ips := make([]net.IP, 0, len(addrs))
+    for _, a := range addrs {
+        ips = append(ips, a.IP)
+    }
+    return ips, nil
+}
+
+// resolveTarget returns addresses to probe with the preferred address family first
+func resolveTarget(t Target, timeout time.Duration) ([]net.IP, error) {
+    if t.ip != nil {
+        return []net.IP{t.ip}, nil
+    }
+    ips, err := resolveHost(t.Host, timeout)
+    if err != nil {
+        return nil, err
+    }
+
+    preferIPv4 := strings.ToLower(t.PreferredFamily) == "ip4"
+    preferIPv6 := strings.ToLower(t.PreferredFamily) == "ip6"
+    sort.SliceStable(ips, func(i, j int) bool {
+        iIsIPv4, jIsIPv4 := ips[i].To4() != nil, ips[j].To4() != nil
+        return (preferIPv4 && iIsIPv4 && !jIsIPv4) || (preferIPv6 && !iIsIPv4 && jIsIPv4)
+    })
+    return ips, nil
+}
+
+func targetTimeout(t Target, defaultValue time.Duration) time.Duration {
+    if t.Timeout == 0 {
+        return defaultValue
+    }
+    return t.Timeout
+}
+
+func checkTCPTarget(t Target) ResultTarget {
+    address := net.JoinHostPort(t.Host, strconv.Itoa(int(t.Port)))
+    result := ResultTarget{
         Host: t.Host, 
         Port: t.Port,
         Protocol: t.Protocol,
-        IsOpen: true,
+        IsOpen: false,
     }
-    
+
+    if t.TLS {
+        // reported as failed handshake if the host is not reachable
+        result.TLS = &TLSResult{ServerName: tlsServerName(t)}
+    }
+
+    timeout := targetTimeout(t, defaultTimeout)
+
+    // DNS resolution and TCP connect are done separately to measure each phase
+    start := time.Now()
+    deadline := start.Add(timeout)
+    ips, err := resolveTarget(t, timeout)
+    result.ResolveDuration = time.Since(start)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "checkTCPTarget: try resolve host: %s, error: %s\n", address, err)
+        return result
+    }
+
+    start = time.Now()
+    conn, err := dialAddresses(ips, t.Port, deadline)
+    if err == nil {
+        result.ConnectDuration = time.Since(start)
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "checkTCPTarget: try connect to host: %s, error: %s\n", address, err)
+        result.Closed = errors.Is(err, syscall.ECONNREFUSED)
+        return result
+    }
+    defer conn.Close()
+
+    result.IsOpen = true
+    if t.TLS {
+        start = time.Now()
+        var tlsConn net.Conn
+        result.TLS, tlsConn = checkTLS(conn, t)
+        if !result.TLS.HandshakeOK {
+            return result
+        }
+        result.TLSDuration = time.Since(start)
+        conn = tlsConn
+    }
+
+    if script := tcpScript(t); len(script) > 0 {
+        result.Script = &ScriptResult{}
+        failedStep, err := runScript(conn, script, timeout)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "checkTCPTarget: script step %d failed on host: %s, error: %s\n", failedStep, address, err)
+            result.Script.FailedStep = failedStep
+            result.IsOpen = false
+            return result
+        }
+        result.Script.Success = true
+    }
+    return result
 }
 
-func checkUDPTarget(t Target, results chan <- ResultTarget, wg *sync.WaitGroup) {
-    defer wg.Done()
+// dialAddresses connects to the first reachable address, addresses of the
+// family of the first address are dialed one after another and the other
+// family is dialed in parallel after a short delay so a blackholed route of
+// one family does not use up the whole timeout
+func dialAddresses(ips []net.IP, port uint16, deadline time.Time) (net.Conn, error) {
+    var primaries, fallbacks []net.IP
+    for _, ip := range ips {
+        if (ip.To4() != nil) == (ips[0].To4() != nil) {
+            primaries = append(primaries, ip)
+        } else {
+            fallbacks = append(fallbacks, ip)
+        }
+    }
+    if len(fallbacks) == 0 {
+        return dialSerial(context.Background(), primaries, port, deadline)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    type dialResult struct {
+        conn net.Conn
+        err error
+        primary bool
+    }
+    results := make(chan dialResult)
+    dial := func(ips []net.IP, primary bool) {
+        conn, err := dialSerial(ctx, ips, port, deadline)
+        select {
+        case results <- dialResult{conn, err, primary}:
+        case <-ctx.Done():
+            if conn != nil {
+                conn.Close()
+            }
+        }
+    }
 
-    address := fmt.Sprintf("%s:%d", t.Host, t.Port)
+    go dial(primaries, true)
+    fallbackTimer := time.NewTimer(dialFallbackDelay)
+    defer fallbackTimer.Stop()
+
+    // the error of the primary family is reported like the standard dialer does
+    var primaryErr error
+    fallbackStarted := false
+    failed := 0
+    for {
+        select {
+        case <-fallbackTimer.C:
+            if !fallbackStarted {
+                fallbackStarted = true
+                go dial(fallbacks, false)
+            }
+        case r := <-results:
+            if r.err == nil {
+                return r.conn, nil
+            }
+            if r.primary {
+                primaryErr = r.err
+            }
+            failed++
+            if failed == 2 {
+                return nil, primaryErr
+            }
+            if !fallbackStarted {
+                // the primary family failed before the fallback delay
+                fallbackStarted = true
+                fallbackTimer.Stop()
+                go dial(fallbacks, false)
+            }
+        }
+    }
+}
+
+// dialSerial dials the addresses in order, each address gets an equal share
+// of the remaining time but at least minAddressDialTimeout
+func dialSerial(ctx context.Context, ips []net.IP, port uint16, deadline time.Time) (net.Conn, error) {
+    var err error
+    for i, ip := range ips {
+        remaining := time.Until(deadline)
+        if remaining <= 0 {
+            return nil, fmt.Errorf("dial %s: %w", ip, os.ErrDeadlineExceeded)
+        }
+        timeout := remaining / time.Duration(len(ips)-i)
+        if timeout < minAddressDialTimeout {
+            timeout = min(minAddressDialTimeout, remaining)
+        }
+        dialCtx, cancel := context.WithTimeout(ctx, timeout)
+        var conn net.Conn
+        conn, err = (&net.Dialer{}).DialContext(dialCtx, "tcp", net.JoinHostPort(ip.String(), strconv.Itoa(int(port))))
+        cancel()
+        if err == nil {
+            return conn, nil
+        }
+        if ctx.Err() != nil {
+            return nil, err
+        }
+    }
+    return nil, err
+}
+
+func checkUDPTarget(t Target) ResultTarget {
+    address := net.JoinHostPort(t.Host, strconv.Itoa(int(t.Port)))
     result := ResultTarget{
         Host: t.Host, 
         Port: t.Port,
         Protocol: t.Protocol,
         IsOpen: false,
     }
-    conn, err := net.DialTimeout("udp", address, time.Second * 5)
+
+    timeout := targetTimeout(t, defaultUDPTimeout)
+
+    start := time.Now()
+    ips, err := resolveTarget(t, timeout)
+    result.ResolveDuration = time.Since(start)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "checkUDPTarget: try resolve host: %s, error: %s\n", address, err)
+        return result
+    }
+
+    conn, err := net.DialTimeout("udp", net.JoinHostPort(ips[0].String(), strconv.Itoa(int(t.Port))), timeout)
     if err != nil {
         fmt.Fprintf(os.Stderr, "checkUDPTarget: try connect to host: %s, error: %s\n", address, err)
-        results <- result
-        return
+        return result
     }
     defer conn.Close()
 
-    conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+    conn.SetReadDeadline(time.Now().Add(timeout))
 
-	_, err = conn.Write([]byte("hello"))    
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "checkUDPTarget: try send packet to host: %s, error: %s\n", address, err)
-        results <- result
-        return
-	}
+    _, err = conn.Write(t.payload)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "checkUDPTarget: try send packet to host: %s, error: %s\n", address, err)
+        return result
+    }
 
-	buffer := make([]byte, 1024)
-	_, err = conn.Read(buffer)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "checkUDPTarget: try response from host: %s, error: %s\n", address, err)
-        results <- result
-		return
-	}
+    buffer := make([]byte, 65535)
+    n, err := conn.Read(buffer)
+    if err != nil {
+        // ICMP port unreachable is reported as refused connection on connected UDP sockets
+        result.Closed = errors.Is(err, syscall.ECONNREFUSED)
+        fmt.Fprintf(os.Stderr, "checkUDPTarget: try response from host: %s, error: %s\n", address, err)
+        return result
+    }
+
+    if !udpResponseValid(t, buffer[:n]) {
+        fmt.Fprintf(os.Stderr, "checkUDPTarget: unexpected response from host: %s, response: %q\n", address, buffer[:n])
+        return result
+    }
 
     result.IsOpen = true
-    results <- result
+    return result
+}
+
+// checkTarget repeats failed checks so a single lost packet or a slow
+// handshake does not flap the metric
+func checkTarget(t Target, check func(Target) ResultTarget) ResultTarget {
+    retries := 0
+    if t.Retries != nil {
+        retries = *t.Retries
+    }
+    retryInterval := defaultRetryInterval
+    if t.RetryInterval != nil {
+        retryInterval = *t.RetryInterval
+    }
+
+    result := check(t)
+    for i := 0; i < retries && !result.IsOpen; i++ {
+        time.Sleep(retryInterval)
+        result = check(t)
+    }
+    result.Name = t.Name
+    result.Group = t.Group
+    result.Labels = t.Labels
+    return result
 }
 
-func CheckTargets(targets []Target) []ResultTarget {
+// ValidateTargets normalizes protocols of the targets, checks that protocols,
+// probe settings and custom label names are supported and compiles the
+// regexes of the targets in place
+func ValidateTargets(targets []Target) error {
+    for i := range targets {
+        t := &targets[i]
+        t.Protocol = strings.ToUpper(t.Protocol)
+        if _, ok := checkFuncs[t.Protocol]; !ok {
+            return fmt.Errorf("target %d (%s): unknown protocol: %q", i, targetDescription(*t), t.Protocol)
+        }
+        if (t.Retries != nil && *t.Retries < 0) || (t.RetryInterval != nil && *t.RetryInterval < 0) {
+            return fmt.Errorf("target %d (%s): retries and retryInterval must not be negative", i, targetDescription(*t))
+        }
+        if f := strings.ToLower(t.PreferredFamily); f != "" && f != "ip4" && f != "ip6" {
+            return fmt.Errorf("target %d (%s): unknown preferredFamily: %q", i, targetDescription(*t), t.PreferredFamily)
+        }
+        if err := validatePreset(*t); err != nil {
+            return fmt.Errorf("target %d (%s): %v", i, targetDescription(*t), err)
+        }
+        if err := validateTLS(*t); err != nil {
+            return fmt.Errorf("target %d (%s): %v", i, targetDescription(*t), err)
+        }
+        if err := compileTarget(t); err != nil {
+            return fmt.Errorf("target %d (%s): %v", i, targetDescription(*t), err)
+        }
+        if err := compileScript(t.Script); err != nil {
+            return fmt.Errorf("target %d (%s): %v", i, targetDescription(*t), err)
+        }
+        for name := range t.Labels {
+            if !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+                return fmt.Errorf("target %d (%s): invalid label name: %q", i, targetDescription(*t), name)
+            }
+            if slices.Contains(reservedLabelNames, name) {
+                return fmt.Errorf("target %d (%s): label name %q is reserved", i, targetDescription(*t), name)
+            }
+        }
+    }
+    return nil
+}
+
+// compileTarget checks and compiles the protocol specific probe settings
+func compileTarget(t *Target) error {
+    switch t.Protocol {
+    case "HTTP":
+        return compileHTTPTarget(t)
+    case "DNS":
+        return compileDNSTarget(t)
+    case "UDP":
+        return compileUDPTarget(t)
+    }
+    return nil
+}
+
+func validatePreset(t Target) error {
+    if t.Preset == "" {
+        return nil
+    }
+    preset := strings.ToLower(t.Preset)
+    if t.Protocol == "TCP" {
+        if _, ok := tcpPresets[preset]; !ok {
+            return fmt.Errorf("unknown TCP preset: %q", t.Preset)
+        }
+    }
+    if t.Protocol == "UDP" {
+        if _, ok := udpPresets[preset]; !ok {
+            return fmt.Errorf("unknown UDP preset: %q", t.Preset)
+        }
+    }
+    return nil
+}
+
+// CustomLabelNames returns sorted names of custom labels of all targets
+func CustomLabelNames(targets []Target) []string {
+    var names []string
+    for _, t := range targets {
+        for name := range t.Labels {
+            if !slices.Contains(names, name) {
+                names = append(names, name)
+            }
+        }
+    }
+    sort.Strings(names)
+    return names
+}
+
+func targetDescription(t Target) string {
+    if t.Name != "" {
+        return t.Name
+    }
+    if t.URL != "" {
+        return t.URL
+    }
+    if t.Query != "" {
+        return t.Query
+    }
+    return net.JoinHostPort(t.Host, strconv.Itoa(int(t.Port)))
+}
+
+// checkAllAddresses probes each address of the host separately so a single
+// broken backend behind round-robin DNS is visible
+func checkAllAddresses(t Target, check func(Target) ResultTarget) []ResultTarget {
+    start := time.Now()
+    ips, err := resolveTarget(t, targetTimeout(t, defaultTimeout))
+    resolveDuration := time.Since(start)
+    if err != nil {
+        // the check reports the resolve error
+        return []ResultTarget{checkTarget(t, check)}
+    }
+
+    var results []ResultTarget
+    for _, ip := range ips {
+        addressTarget := t
+        addressTarget.ip = ip
+        result := checkTarget(addressTarget, check)
+        result.IP = ip.String()
+        result.ResolveDuration = resolveDuration
+        results = append(results, result)
+    }
+    return results
+}
+
+func CheckTargets(targets []Target, maxConcurrency int) []ResultTarget {
+    if maxConcurrency <= 0 {
+        maxConcurrency = DefaultMaxConcurrency
+    }
+
     var wg sync.WaitGroup
     results := make(chan ResultTarget)
+    semaphore := make(chan struct{}, maxConcurrency)
 
     for _, t := range targets {
-        if t.Protocol == "TCP" {
-            wg.Add(1)
-            go checkTCPTarget(t, results, &wg)
-        }
-        if t.Protocol == "UDP" {
-            wg.Add(1)
-            go checkUDPTarget(t, results, &wg)
+        check, ok := checkFuncs[t.Protocol]
+        if !ok {
+            fmt.Fprintf(os.Stderr, "CheckTargets: unknown protocol: %s of target: %s\n", t.Protocol, targetDescription(t))
+            continue
         }
+        wg.Add(1)
+        go func(t Target) {
+            defer wg.Done()
+            semaphore <- struct{}{}
+            defer func() { <-semaphore }()
+            if t.ResolveAll && (t.Protocol == "TCP" || t.Protocol == "UDP") {
+                for _, r := range checkAllAddresses(t, check) {
+                    results <- r
+                }
+                return
+            }
+            results <- checkTarget(t, check)
+        }(t)
     }
     go func() {
         wg.Wait()
@@ -108,8 +587,8 @@ func CheckTargets(targets []Target) []ResultTarget {
     }()
     
     var resultTargets []ResultTarget
-	for r := range results {
+    for r := range results {
         resultTargets = append(resultTargets, r)
-	}
+    }
     return resultTargets
-}
\ No newline at end of file
+}
@@ -0,0 +1,75 @@
+package network
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateTargetsLabels(t *testing.T) {
+	for _, tc := range []struct {
+		label string
+		err   string
+	}{
+		{"team", ""},
+		{"le", "reserved"},
+		{"quantile", "reserved"},
+		{"host", "reserved"},
+		{"__meta", "invalid label name"},
+		{"1team", "invalid label name"},
+	} {
+		targets := []Target{{Host: "localhost", Port: 22, Protocol: "tcp", Labels: map[string]string{tc.label: "x"}}}
+		err := ValidateTargets(targets)
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("label %q: unexpected error: %v", tc.label, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("label %q: got error %v, expected %q", tc.label, err, tc.err)
+		}
+	}
+}
+
+func TestValidateTargetsTLS(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		target Target
+		err    string
+	}{
+		{"tcp", Target{Host: "localhost", Port: 443, Protocol: "tcp", TLS: true, ServerName: "example.com"}, ""},
+		{"starttls", Target{Host: "localhost", Port: 25, Protocol: "tcp", TLS: true, StartTLS: "SMTP"}, ""},
+		{"udp", Target{Host: "localhost", Port: 443, Protocol: "udp", TLS: true}, "only supported for TCP"},
+		{"http", Target{URL: "https://localhost", Protocol: "http", TLS: true}, "only supported for TCP"},
+		{"server name without tls", Target{Host: "localhost", Port: 443, Protocol: "tcp", ServerName: "example.com"}, "serverName requires tls"},
+		{"starttls without tls", Target{Host: "localhost", Port: 25, Protocol: "tcp", StartTLS: "smtp"}, "startTLS requires tls"},
+		{"unknown starttls", Target{Host: "localhost", Port: 21, Protocol: "tcp", TLS: true, StartTLS: "ftp"}, "unsupported startTLS"},
+	} {
+		err := ValidateTargets([]Target{tc.target})
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: got error %v, expected %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestValidateTargetsHTTP(t *testing.T) {
+	for _, tc := range []struct {
+		url string
+		err string
+	}{
+		{"https://example.com/health", ""},
+		{"http://127.0.0.1:8080", ""},
+		{"", "url is required"},
+		{"example.com/health", "invalid url"},
+		{"ftp://example.com", "invalid url"},
+		{"http://exa mple.com", "invalid url"},
+	} {
+		err := ValidateTargets([]Target{{Protocol: "http", URL: tc.url}})
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("url %q: unexpected error: %v", tc.url, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("url %q: got error %v, expected %q", tc.url, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// limit of data buffered while waiting for the expected response
+	maxScriptResponseSize = 64 * 1024
+)
+
+var (
+	tcpPresets = map[string][]ScriptStep{
+		"redis": mustCompileScript([]ScriptStep{
+			{Send: "PING\r\n", Expect: `^\+PONG`},
+		}),
+		"ssh": mustCompileScript([]ScriptStep{
+			{Expect: `^SSH-2\.0-`},
+		}),
+		"smtp": mustCompileScript([]ScriptStep{
+			{Expect: `^220[ -]`},
+			{Send: "QUIT\r\n"},
+		}),
+		// initial handshake packet: 3 bytes payload length, sequence id 0 and protocol version 10
+		"mysql": mustCompileScript([]ScriptStep{
+			{Expect: `(?s)^.{3}\x00\x0a`},
+		}),
+		"memcached": mustCompileScript([]ScriptStep{
+			{Send: "stats\r\n", Expect: `STAT pid `},
+		}),
+	}
+)
+
+type ScriptStep struct {
+	Send    string        `yaml:"send"`
+	SendHex string        `yaml:"sendHex"`
+	Expect  string        `yaml:"expect"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	// compiled by compileScript
+	payload []byte
+	expect  *regexp.Regexp
+}
+
+type ScriptResult struct {
+	Success bool
+	// number of the failed step starting from 1, 0 if all steps passed
+	FailedStep int
+}
+
+// tcpScript returns the configured script or the script of the preset
+func tcpScript(t Target) []ScriptStep {
+	if len(t.Script) > 0 {
+		return t.Script
+	}
+	return tcpPresets[strings.ToLower(t.Preset)]
+}
+
+// compileScript decodes the data to send and compiles the expect regexes of
+// the steps in place
+func compileScript(steps []ScriptStep) error {
+	for i := range steps {
+		step := &steps[i]
+		step.payload = []byte(step.Send)
+		if step.SendHex != "" {
+			decoded, err := decodeHex(step.SendHex)
+			if err != nil {
+				return fmt.Errorf("script step %d: invalid sendHex: %v", i+1, err)
+			}
+			step.payload = decoded
+		}
+		step.expect = nil
+		if step.Expect != "" {
+			re, err := regexp.Compile(step.Expect)
+			if err != nil {
+				return fmt.Errorf("script step %d: invalid expect: %v", i+1, err)
+			}
+			step.expect = re
+		}
+	}
+	return nil
+}
+
+func mustCompileScript(steps []ScriptStep) []ScriptStep {
+	if err := compileScript(steps); err != nil {
+		panic(err)
+	}
+	return steps
+}
+
+// runScript sends data and waits for the expected response step by step, a
+// step may only send or only expect; steps must be compiled with compileScript
+func runScript(conn net.Conn, steps []ScriptStep, timeout time.Duration) (int, error) {
+	var buffer []byte
+	chunk := make([]byte, 4096)
+
+	for i, step := range steps {
+		stepTimeout := step.Timeout
+		if stepTimeout == 0 {
+			stepTimeout = timeout
+		}
+		conn.SetDeadline(time.Now().Add(stepTimeout))
+
+		if len(step.payload) > 0 {
+			if _, err := conn.Write(step.payload); err != nil {
+				return i + 1, fmt.Errorf("send: %w", err)
+			}
+			// response of the previous step must not match the next expect
+			buffer = buffer[:0]
+		}
+
+		re := step.expect
+		if re == nil {
+			continue
+		}
+		for !re.Match(buffer) {
+			if len(buffer) >= maxScriptResponseSize {
+				return i + 1, fmt.Errorf("response does not match %q: %q", step.Expect, truncate(buffer))
+			}
+			n, err := conn.Read(chunk)
+			buffer = append(buffer, chunk[:n]...)
+			if err != nil && !re.Match(buffer) {
+				return i + 1, fmt.Errorf("expect %q: %w, received: %q", step.Expect, err, truncate(buffer))
+			}
+		}
+		buffer = buffer[:0]
+	}
+	return 0, nil
+}
+
+func truncate(b []byte) []byte {
+	b = bytes.TrimSpace(b)
+	if len(b) > 128 {
+		return b[:128]
+	}
+	return b
+}
@@ -0,0 +1,118 @@
+package network
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptServer writes the greeting and answers every request with its
+// response, the connection is closed when the client closes it or sends an
+// unknown request
+func scriptServer(conn net.Conn, greeting string, responses map[string]string) {
+	defer conn.Close()
+	if greeting != "" {
+		if _, err := conn.Write([]byte(greeting)); err != nil {
+			return
+		}
+	}
+	buffer := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return
+		}
+		response, ok := responses[string(buffer[:n])]
+		if !ok {
+			return
+		}
+		if _, err := conn.Write([]byte(response)); err != nil {
+			return
+		}
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		greeting   string
+		responses  map[string]string
+		steps      []ScriptStep
+		failedStep int
+		err        string
+	}{
+		{
+			name:     "greeting matches",
+			greeting: "SSH-2.0-OpenSSH_9.2\r\n",
+			steps:    []ScriptStep{{Expect: `^SSH-2\.0-`}},
+		},
+		{
+			name:      "send and expect",
+			responses: map[string]string{"PING\r\n": "+PONG\r\n"},
+			steps:     []ScriptStep{{Send: "PING\r\n", Expect: `^\+PONG`}},
+		},
+		{
+			name:      "send hex",
+			responses: map[string]string{"\x00\x01": "\x02\x03"},
+			steps:     []ScriptStep{{SendHex: "0x00 01", Expect: `^\x02\x03`}},
+		},
+		{
+			name:      "number of the failed step",
+			greeting:  "220 mail.example.com ESMTP\r\n",
+			responses: map[string]string{"EHLO test\r\n": "250 OK\r\n", "MAIL FROM:<>\r\n": "550 rejected\r\n"},
+			steps: []ScriptStep{
+				{Expect: `^220 `},
+				{Send: "EHLO test\r\n", Expect: `^250 `},
+				{Send: "MAIL FROM:<>\r\n", Expect: `^250 `},
+			},
+			failedStep: 3,
+			err:        "550 rejected",
+		},
+		{
+			// the greeting matches the expect of the second step but it was
+			// received before the send
+			name:      "buffer is reset after a send",
+			greeting:  "+PONG\r\n",
+			responses: map[string]string{"PING\r\n": "-ERR unknown\r\n"},
+			steps: []ScriptStep{
+				{Expect: `^\+`},
+				{Send: "PING\r\n", Expect: `\+PONG`},
+			},
+			failedStep: 2,
+			err:        "ERR unknown",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := compileScript(tc.steps); err != nil {
+				t.Fatal(err)
+			}
+			client, server := net.Pipe()
+			defer client.Close()
+			go scriptServer(server, tc.greeting, tc.responses)
+
+			failedStep, err := runScript(client, tc.steps, 250*time.Millisecond)
+			if failedStep != tc.failedStep {
+				t.Errorf("failed step: got %d, expected %d, error: %v", failedStep, tc.failedStep, err)
+			}
+			switch {
+			case tc.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Errorf("got error %v, expected %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestCompileScript(t *testing.T) {
+	for _, steps := range [][]ScriptStep{
+		{{Expect: "ok"}, {Expect: "("}},
+		{{Send: "a"}, {SendHex: "0x0"}},
+	} {
+		err := compileScript(steps)
+		if err == nil || !strings.Contains(err.Error(), "script step 2") {
+			t.Errorf("got error %v, expected an error of step 2", err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package network
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+type TLSResult struct {
+	HandshakeOK  bool
+	Version      string
+	ServerName   string
+	NotBefore    time.Time
+	NotAfter     time.Time
+	Subject      string
+	Issuer       string
+	DNSNames     []string
+	SerialNumber string
+	Verified     bool
+}
+
+// checkTLS performs a TLS handshake over an already established connection
+// and returns the TLS connection if the handshake succeeded.
+// Certificate verification is done separately from the handshake so the
+// certificate details are reported even if the chain is not trusted.
+func checkTLS(conn net.Conn, t Target) (*TLSResult, net.Conn) {
+	address := net.JoinHostPort(t.Host, fmt.Sprint(t.Port))
+
+	serverName := tlsServerName(t)
+	result := &TLSResult{
+		ServerName: serverName,
+	}
+
+	timeout := targetTimeout(t, defaultTimeout)
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if t.StartTLS != "" {
+		if err := startTLS(conn, t.StartTLS); err != nil {
+			fmt.Fprintf(os.Stderr, "checkTLS: starttls %s with host: %s, error: %s\n", t.StartTLS, address, err)
+			return result, nil
+		}
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		fmt.Fprintf(os.Stderr, "checkTLS: handshake with host: %s, error: %s\n", address, err)
+		return result, nil
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		fmt.Fprintf(os.Stderr, "checkTLS: host: %s did not present a certificate\n", address)
+		return result, nil
+	}
+	result.HandshakeOK = true
+	result.Version = tls.VersionName(state.Version)
+
+	leaf := state.PeerCertificates[0]
+	result.NotBefore = leaf.NotBefore
+	result.NotAfter = leaf.NotAfter
+	result.Subject = leaf.Subject.String()
+	result.Issuer = leaf.Issuer.String()
+	result.DNSNames = leaf.DNSNames
+	result.SerialNumber = leaf.SerialNumber.Text(16)
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	// IP literals without a server name are checked against the IP SANs
+	verifyName := serverName
+	if verifyName == "" {
+		verifyName = t.Host
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       verifyName,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "checkTLS: verify certificate of host: %s, error: %s\n", address, err)
+	} else {
+		result.Verified = true
+	}
+
+	return result, tlsConn
+}
+
+// tlsServerName returns the configured server name or the host if it is not
+// an IP address
+func tlsServerName(t Target) string {
+	if t.ServerName == "" && net.ParseIP(t.Host) == nil {
+		return t.Host
+	}
+	return t.ServerName
+}
+
+var (
+	// protocols supported by startTLS of TCP targets
+	startTLSFuncs = map[string]func(net.Conn) error{
+		"smtp":     startTLSSMTP,
+		"imap":     startTLSIMAP,
+		"postgres": startTLSPostgres,
+	}
+)
+
+func startTLS(conn net.Conn, protocol string) error {
+	start, ok := startTLSFuncs[strings.ToLower(protocol)]
+	if !ok {
+		return fmt.Errorf("unsupported protocol: %s", protocol)
+	}
+	return start(conn)
+}
+
+// validateTLS checks that tls is only enabled for TCP targets and that
+// startTLS is supported
+func validateTLS(t Target) error {
+	if t.TLS && t.Protocol != "TCP" {
+		return fmt.Errorf("tls is only supported for TCP targets")
+	}
+	if t.ServerName != "" && !t.TLS {
+		return fmt.Errorf("serverName requires tls")
+	}
+	if t.StartTLS == "" {
+		return nil
+	}
+	if _, ok := startTLSFuncs[strings.ToLower(t.StartTLS)]; !ok {
+		return fmt.Errorf("unsupported startTLS protocol: %q", t.StartTLS)
+	}
+	if !t.TLS {
+		return fmt.Errorf("startTLS requires tls")
+	}
+	return nil
+}
+
+func startTLSSMTP(conn net.Conn) error {
+	reader := textproto.NewReader(bufio.NewReader(conn))
+
+	if _, _, err := reader.ReadResponse(220); err != nil {
+		return fmt.Errorf("greeting: %w", err)
+	}
+	if _, err := fmt.Fprintf(conn, "EHLO custom-exporter\r\n"); err != nil {
+		return err
+	}
+	if _, _, err := reader.ReadResponse(250); err != nil {
+		return fmt.Errorf("EHLO: %w", err)
+	}
+	if _, err := fmt.Fprintf(conn, "STARTTLS\r\n"); err != nil {
+		return err
+	}
+	if _, _, err := reader.ReadResponse(220); err != nil {
+		return fmt.Errorf("STARTTLS: %w", err)
+	}
+	return nil
+}
+
+func startTLSIMAP(conn net.Conn) error {
+	reader := textproto.NewReader(bufio.NewReader(conn))
+
+	greeting, err := reader.ReadLine()
+	if err != nil {
+		return fmt.Errorf("greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+	if _, err := fmt.Fprintf(conn, "a1 STARTTLS\r\n"); err != nil {
+		return err
+	}
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return fmt.Errorf("STARTTLS: %w", err)
+		}
+		if strings.HasPrefix(line, "a1 ") {
+			if !strings.HasPrefix(line, "a1 OK") {
+				return fmt.Errorf("STARTTLS rejected: %s", line)
+			}
+			return nil
+		}
+	}
+}
+
+func startTLSPostgres(conn net.Conn) error {
+	// SSLRequest message: length 8 and the magic code 80877103
+	if _, err := conn.Write([]byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}); err != nil {
+		return err
+	}
+	response := make([]byte, 1)
+	if _, err := conn.Read(response); err != nil {
+		return fmt.Errorf("SSLRequest: %w", err)
+	}
+	if response[0] != 'S' {
+		return fmt.Errorf("server does not support SSL")
+	}
+	return nil
+}
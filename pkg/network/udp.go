@@ -0,0 +1,110 @@
+package network
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	defaultUDPPayload = []byte("hello")
+
+	udpPresets = map[string]udpPreset{
+		// query of NS records of the root zone with id 0x1337
+		"dns": {
+			payload: []byte{
+				0x13, 0x37, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x02, 0x00, 0x01,
+			},
+			validate: func(b []byte) bool {
+				return len(b) >= 12 && b[0] == 0x13 && b[1] == 0x37 && b[2]&0x80 != 0
+			},
+		},
+		// NTPv3 client request, the server answers in mode 4
+		"ntp": {
+			payload: append([]byte{0x1b}, make([]byte, 47)...),
+			validate: func(b []byte) bool {
+				return len(b) >= 48 && b[0]&0x07 == 4
+			},
+		},
+		// SNMPv2c get of sysDescr.0 with community "public"
+		"snmp": {
+			payload: []byte{
+				0x30, 0x26, 0x02, 0x01, 0x01, 0x04, 0x06, 0x70, 0x75, 0x62, 0x6c, 0x69,
+				0x63, 0xa0, 0x19, 0x02, 0x01, 0x01, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00,
+				0x30, 0x0e, 0x30, 0x0c, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01,
+				0x01, 0x00, 0x05, 0x00,
+			},
+			validate: func(b []byte) bool {
+				return len(b) > 0 && b[0] == 0x30 && bytes.IndexByte(b, 0xa2) >= 0
+			},
+		},
+	}
+)
+
+type udpPreset struct {
+	payload  []byte
+	validate func([]byte) bool
+}
+
+// compileUDPTarget decodes the payload and the expected response of the
+// target, explicit payloads take precedence over presets
+func compileUDPTarget(t *Target) error {
+	switch {
+	case t.PayloadHex != "":
+		payload, err := decodeHex(t.PayloadHex)
+		if err != nil {
+			return fmt.Errorf("invalid payloadHex: %v", err)
+		}
+		t.payload = payload
+	case t.Payload != "":
+		t.payload = []byte(t.Payload)
+	case t.Preset != "":
+		preset, ok := udpPresets[strings.ToLower(t.Preset)]
+		if !ok {
+			return fmt.Errorf("unknown preset: %s", t.Preset)
+		}
+		t.payload = preset.payload
+	default:
+		t.payload = defaultUDPPayload
+	}
+
+	if t.ExpectHex != "" {
+		prefix, err := decodeHex(t.ExpectHex)
+		if err != nil {
+			return fmt.Errorf("invalid expectHex: %v", err)
+		}
+		t.expectHex = prefix
+	}
+	if t.Expect != "" {
+		re, err := regexp.Compile(t.Expect)
+		if err != nil {
+			return fmt.Errorf("invalid expect: %v", err)
+		}
+		t.expect = re
+	}
+	return nil
+}
+
+// udpResponseValid checks the response against expect or expectHex, without
+// them the response is validated by the preset, otherwise any response is valid
+func udpResponseValid(t Target, response []byte) bool {
+	if t.expectHex != nil {
+		return bytes.HasPrefix(response, t.expectHex)
+	}
+	if t.expect != nil {
+		return t.expect.Match(response)
+	}
+	if preset, ok := udpPresets[strings.ToLower(t.Preset)]; ok {
+		return preset.validate(response)
+	}
+	return true
+}
+
+// decodeHex accepts hex strings with optional spaces and 0x prefix
+func decodeHex(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.ReplaceAll(s, " ", ""), "0x")
+	return hex.DecodeString(s)
+}
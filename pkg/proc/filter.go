@@ -0,0 +1,176 @@
+package proc
+
+import (
+	"fmt"
+	"os/user"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultMaxPidSeries = 20
+)
+
+var (
+	userNames      = make(map[uint64]string)
+	userNamesMutex sync.Mutex
+)
+
+// ProcessFilter matches processes by all configured criteria, regexes are
+// not anchored
+type ProcessFilter struct {
+	Process string `yaml:"process"`
+	// regex of the process name from /proc/<pid>/stat, truncated to 15 characters
+	Regex string `yaml:"regex"`
+	// regex of the full command line with arguments separated by spaces
+	Cmdline string `yaml:"cmdline"`
+	// regex of the resolved path of /proc/<pid>/exe
+	Exe string `yaml:"exe"`
+	// name or uid of the effective user
+	User string `yaml:"user"`
+	// regex of the parent process name
+	ParentComm string `yaml:"parentComm"`
+	// regex of the cgroup path, e.g. a systemd unit
+	Cgroup string `yaml:"cgroup"`
+	// expected number of matching processes, unbounded if not set
+	Min *int `yaml:"min"`
+	Max *int `yaml:"max"`
+	// export series per process, limited to maxPidSeries processes with the
+	// highest resident memory
+	PerPid       bool `yaml:"perPid"`
+	MaxPidSeries int  `yaml:"maxPidSeries"`
+	// read /proc/<pid>/smaps_rollup for PSS, USS and swap, expensive for
+	// processes with many mappings
+	SmapsRollup bool `yaml:"smapsRollup"`
+
+	// compiled by CompileProcessFilters, nil if the criterion is not set
+	regex      *regexp.Regexp
+	cmdline    *regexp.Regexp
+	exe        *regexp.Regexp
+	parentComm *regexp.Regexp
+	cgroup     *regexp.Regexp
+}
+
+// CompileProcessFilters checks that every filter has a process name and at
+// least one criterion and compiles the regexes of the filters in place
+func CompileProcessFilters(filters []ProcessFilter) error {
+	for i := range filters {
+		f := &filters[i]
+		if f.Process == "" {
+			return fmt.Errorf("process name is required for filter with regex %q", f.Regex)
+		}
+		if f.Regex == "" && f.Cmdline == "" && f.Exe == "" && f.User == "" && f.ParentComm == "" && f.Cgroup == "" {
+			return fmt.Errorf("process %s: at least one of regex, cmdline, exe, user, parentComm, cgroup is required", f.Process)
+		}
+		if (f.Min != nil && *f.Min < 0) || (f.Max != nil && *f.Max < 0) {
+			return fmt.Errorf("process %s: min and max must not be negative", f.Process)
+		}
+		if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+			return fmt.Errorf("process %s: min %d is greater than max %d", f.Process, *f.Min, *f.Max)
+		}
+		if f.MaxPidSeries < 0 {
+			return fmt.Errorf("process %s: maxPidSeries must not be negative", f.Process)
+		}
+		if f.PerPid && f.MaxPidSeries == 0 {
+			f.MaxPidSeries = defaultMaxPidSeries
+		}
+		for _, r := range []struct {
+			name   string
+			expr   string
+			target **regexp.Regexp
+		}{
+			{"regex", f.Regex, &f.regex},
+			{"cmdline", f.Cmdline, &f.cmdline},
+			{"exe", f.Exe, &f.exe},
+			{"parentComm", f.ParentComm, &f.parentComm},
+			{"cgroup", f.Cgroup, &f.cgroup},
+		} {
+			if r.expr == "" {
+				continue
+			}
+			re, err := regexp.Compile(r.expr)
+			if err != nil {
+				return fmt.Errorf("process %s: invalid %s regex: %v", f.Process, r.name, err)
+			}
+			*r.target = re
+		}
+	}
+	return nil
+}
+
+// matches checks all configured criteria of the filter, cheap criteria are
+// checked first; attributes which can not be read (kernel threads, processes
+// of other users) do not match
+func (f ProcessFilter) matches(s *Snapshot, p *Process) bool {
+	if f.regex != nil && !f.regex.MatchString(p.Stat.Comm) {
+		return false
+	}
+	if f.parentComm != nil && !f.parentComm.MatchString(s.parentComm(p)) {
+		return false
+	}
+	if f.User != "" {
+		uid, ok := p.EffectiveUID()
+		if !ok || (f.User != strconv.FormatUint(uid, 10) && f.User != userName(uid)) {
+			return false
+		}
+	}
+	if f.cmdline != nil {
+		cmdline := p.Cmdline()
+		if cmdline == "" || !f.cmdline.MatchString(cmdline) {
+			return false
+		}
+	}
+	if f.exe != nil {
+		exe := p.Exe()
+		if exe == "" || !f.exe.MatchString(exe) {
+			return false
+		}
+	}
+	if f.cgroup != nil {
+		found := false
+		for _, path := range p.Cgroups() {
+			if f.cgroup.MatchString(path) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// HasExpectedCount returns true if min or max is set
+func (f ProcessFilter) HasExpectedCount() bool {
+	return f.Min != nil || f.Max != nil
+}
+
+// CountWithinExpected checks the number of matching processes against min and max
+func (f ProcessFilter) CountWithinExpected(count int) bool {
+	if f.Min != nil && count < *f.Min {
+		return false
+	}
+	if f.Max != nil && count > *f.Max {
+		return false
+	}
+	return true
+}
+
+// userName returns the name of the user with the uid, names are cached
+// because the lookup reads /etc/passwd
+func userName(uid uint64) string {
+	userNamesMutex.Lock()
+	defer userNamesMutex.Unlock()
+
+	if name, ok := userNames[uid]; ok {
+		return name
+	}
+	name := ""
+	if u, err := user.LookupId(strconv.FormatUint(uid, 10)); err == nil {
+		name = u.Username
+	}
+	userNames[uid] = name
+	return name
+}
@@ -1,9 +1,16 @@
 package proc
 
 import (
-	"regexp"	
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/prometheus/procfs"
-	
 )
 
 var (
@@ -23,30 +30,82 @@ var (
 	}
 )
 
-type ProcessFilter struct {
-	Process string `yaml:"process"`
-	Regex   string `yaml:"regex"`
+// Snapshot holds all processes read once per collection cycle, every metric
+// of the cycle is derived from it
+type Snapshot struct {
+	Processes []*Process
+	// errors other than vanished processes and denied access, the snapshot
+	// contains all processes which could be read
+	ScanErrors int
+	byPID      map[int]*Process
+	// boot time in seconds since the epoch, process start times are relative to it
+	bootTime uint64
+	takenAt  time.Time
 }
 
-type ProcessUsage struct {
-	CPUTime        float64
-	ResidentMemory uint64
+// Process is a process of the snapshot, attributes other than stat are read
+// on first use and cached for the cycle
+type Process struct {
+	PID      int
+	Stat     procfs.ProcStat
+	proc     procfs.Proc
+	snapshot *Snapshot
+
+	cmdline *string
+	exe     *string
+	status  *procfs.ProcStatus
+	cgroups []string
 }
 
-func CountProcesses() (int, error) {
+func TakeSnapshot() (*Snapshot, error) {
 	procs, err := procfs.AllProcs()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return len(procs), nil
-}
 
-func CountProcessTypes() (map[string]int, error) {
-	procs, err := procfs.AllProcs()
+	fs, err := procfs.NewDefaultFS()
 	if err != nil {
 		return nil, err
 	}
+	stat, err := fs.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{
+		Processes: make([]*Process, 0, len(procs)),
+		byPID:     make(map[int]*Process, len(procs)),
+		bootTime:  stat.BootTime,
+		takenAt:   time.Now(),
+	}
+	for _, p := range procs {
+		stat, err := p.Stat()
+		if err != nil {
+			snapshot.scanError(p.PID, err)
+			continue
+		}
+		process := &Process{PID: p.PID, Stat: stat, proc: p, snapshot: snapshot}
+		snapshot.Processes = append(snapshot.Processes, process)
+		snapshot.byPID[p.PID] = process
+	}
+	return snapshot, nil
+}
+
+// scanError counts errors of reading a process, processes exiting during
+// the scan and files which are not readable for the exporter are skipped
+func (s *Snapshot) scanError(pid int, err error) {
+	if err == nil || errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ESRCH) || errors.Is(err, fs.ErrPermission) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "proc: read process %d: %v\n", pid, err)
+	s.ScanErrors++
+}
+
+func (s *Snapshot) CountProcesses() int {
+	return len(s.Processes)
+}
 
+func (s *Snapshot) CountProcessTypes() map[string]int {
 	processTypes := map[string]int{
 		"running":                    0,
 		"idle":                       0,
@@ -60,120 +119,108 @@ func CountProcessTypes() (map[string]int, error) {
 		"waking":                     0,
 		"parked":                     0,
 	}
-	for _, proc := range procs {
-		stat, err := proc.Stat()
-		if err != nil {
-			return nil, err
-		}
-		processTypes[processTypesMap[stat.State]]++
+	for _, p := range s.Processes {
+		processTypes[processTypesMap[p.Stat.State]]++
 	}
-
-	return processTypes, nil
+	return processTypes
 }
 
-
-func findProcessByName(regex string) ([]int, error) {
-	procs, err := procfs.AllProcs()
-	if err != nil {
-		return nil, err
-	}
-	var matchingProcs []int
-	for _, proc := range procs {
-		stat, err := proc.Stat()
-		if err != nil {
-			return nil, err
-		}
-		match, err := regexp.MatchString(regex, stat.Comm)
-		if err != nil {
-			return nil, err
-		}
-		if match {
-			matchingProcs = append(matchingProcs, proc.PID)
+// MatchProcesses returns processes matching each filter by filter process
+// name, filters must be compiled with CompileProcessFilters
+func (s *Snapshot) MatchProcesses(filters []ProcessFilter) map[string][]*Process {
+	result := make(map[string][]*Process, len(filters))
+	for _, filter := range filters {
+		matching := []*Process{}
+		for _, p := range s.Processes {
+			if filter.matches(s, p) {
+				matching = append(matching, p)
+			}
 		}
+		result[filter.Process] = matching
 	}
-	return matchingProcs, nil
+	return result
 }
 
-func aggregateCPUTime(pids []int) (float64, error) {
-	totalCPUTime := 0.0
-	for _, pid := range pids {
-		proc, err := procfs.NewProc(pid)
-		if err != nil {
-			return 0, err
-		}
-		stat, err := proc.Stat()
-		if err != nil {
-			return 0, err
-		}
-		totalCPUTime += float64(stat.CPUTime())
+// parentComm returns the name of the parent process or an empty string if
+// the parent is not in the snapshot
+func (s *Snapshot) parentComm(p *Process) string {
+	if parent, ok := s.byPID[p.Stat.PPID]; ok {
+		return parent.Stat.Comm
 	}
-	return totalCPUTime, nil
+	return ""
 }
 
-func aggregateResidentMemoryUsage(pids []int) (uint64, error) {
-	totalMemory := uint64(0)
-	for _, pid := range pids {
-		proc, err := procfs.NewProc(pid)
-		if err != nil {
-			return 0, err
-		}
-		stat, err := proc.Stat()
-		if err != nil {
-			return 0, err
-		}
-		totalMemory += uint64(stat.ResidentMemory())
-	}
-	return totalMemory, nil
+// StartTime returns the start time of the process in seconds since the epoch
+func (p *Process) StartTime() float64 {
+	return float64(p.snapshot.bootTime) + float64(p.Stat.Starttime)/userHZ
 }
 
-func AggregateCPUTimeAndMemoryUsageByRegex(processes []ProcessFilter) (map[string]ProcessUsage, error) {
-	result := make(map[string]ProcessUsage)
-
-	for _, proc := range processes {
-		matchingProcs, err := findProcessByName(proc.Regex)
-		if err != nil {
-			return nil, err
-		}
-
-		pids := []int{}
-		for _, pid := range matchingProcs {
-			pids = append(pids, pid)
-		}
+// Cmdline returns the command line with arguments separated by spaces, empty
+// for kernel threads and processes which can not be read
+func (p *Process) Cmdline() string {
+	if p.cmdline == nil {
+		cmdline, err := p.proc.CmdLine()
+		p.snapshot.scanError(p.PID, err)
+		joined := strings.Join(cmdline, " ")
+		p.cmdline = &joined
+	}
+	return *p.cmdline
+}
 
-		totalCPUTime, err := aggregateCPUTime(pids)
-		if err != nil {
-			return nil, err
-		}
+// Exe returns the resolved path of /proc/<pid>/exe, empty if it can not be read
+func (p *Process) Exe() string {
+	if p.exe == nil {
+		exe, err := p.proc.Executable()
+		p.snapshot.scanError(p.PID, err)
+		p.exe = &exe
+	}
+	return *p.exe
+}
 
-		totalMemory, err := aggregateResidentMemoryUsage(pids)
+// Status returns /proc/<pid>/status of the process, false if it can not be read
+func (p *Process) Status() (procfs.ProcStatus, bool) {
+	if p.status == nil {
+		status, err := p.proc.NewStatus()
 		if err != nil {
-			return nil, err
+			p.snapshot.scanError(p.PID, err)
+			return procfs.ProcStatus{}, false
 		}
+		p.status = &status
+	}
+	return *p.status, true
+}
 
-		result[proc.Process] = struct {
-			CPUTime         float64
-			ResidentMemory  uint64
-		}{
-			CPUTime:        totalCPUTime,
-			ResidentMemory: totalMemory,
-		}
+// EffectiveUID returns the effective uid of the process, false if the
+// status can not be read
+func (p *Process) EffectiveUID() (uint64, bool) {
+	status, ok := p.Status()
+	if !ok {
+		return 0, false
 	}
+	return status.UIDs[1], true
+}
 
-	return result, nil
+// User returns the name of the effective user or the uid if the user is unknown
+func (p *Process) User() string {
+	uid, ok := p.EffectiveUID()
+	if !ok {
+		return ""
+	}
+	if name := userName(uid); name != "" {
+		return name
+	}
+	return strconv.FormatUint(uid, 10)
 }
 
-func FindProcessesByRegex(processes []ProcessFilter) (map[string]int, error) {
-	result := make(map[string]int)
-	for _, proc := range processes {
-		matchingProcs, err := findProcessByName(proc.Regex)
-		if err != nil {
-			return nil, err
-		}
-		if len(matchingProcs) > 0 {
-			result[proc.Process] = 1
-		} else {
-			result[proc.Process] = 0
+// Cgroups returns the cgroup paths of the process
+func (p *Process) Cgroups() []string {
+	if p.cgroups == nil {
+		p.cgroups = []string{}
+		cgroups, err := p.proc.Cgroups()
+		p.snapshot.scanError(p.PID, err)
+		for _, cgroup := range cgroups {
+			p.cgroups = append(p.cgroups, cgroup.Path)
 		}
 	}
-	return result, nil
-}
\ No newline at end of file
+	return p.cgroups
+}
@@ -0,0 +1,120 @@
+package proc
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+const (
+	// number of processes in /proc during the benchmarks, child processes are
+	// started until it is reached
+	defaultBenchmarkProcesses = 5000
+	benchmarkProcessesEnv     = "PROC_BENCHMARK_PROCESSES"
+)
+
+var (
+	benchmarkChildren     []*exec.Cmd
+	benchmarkChildrenErr  error
+	benchmarkChildrenOnce sync.Once
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	for _, cmd := range benchmarkChildren {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	os.Exit(code)
+}
+
+// startBenchmarkProcesses starts sleeping child processes until the host has
+// the number of processes of PROC_BENCHMARK_PROCESSES, 5000 by default; the
+// children are shared by all benchmarks and killed by TestMain
+func startBenchmarkProcesses(b *testing.B) {
+	benchmarkChildrenOnce.Do(func() {
+		target := defaultBenchmarkProcesses
+		if value := os.Getenv(benchmarkProcessesEnv); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				benchmarkChildrenErr = fmt.Errorf("invalid %s: %v", benchmarkProcessesEnv, err)
+				return
+			}
+			target = n
+		}
+		procs, err := os.ReadDir("/proc")
+		if err != nil {
+			benchmarkChildrenErr = err
+			return
+		}
+		current := 0
+		for _, p := range procs {
+			if _, err := strconv.Atoi(p.Name()); err == nil {
+				current++
+			}
+		}
+		for ; current < target; current++ {
+			cmd := exec.Command("sleep", "3600")
+			if err := cmd.Start(); err != nil {
+				benchmarkChildrenErr = fmt.Errorf("start child process %d of %d: %v", current, target, err)
+				return
+			}
+			benchmarkChildren = append(benchmarkChildren, cmd)
+		}
+	})
+	if benchmarkChildrenErr != nil {
+		b.Skipf("%v, lower %s", benchmarkChildrenErr, benchmarkProcessesEnv)
+	}
+}
+
+// benchmarkFilters covers every criterion, cmdline, exe and cgroup read
+// files of the process on first use
+func benchmarkFilters(b *testing.B) []ProcessFilter {
+	filters := []ProcessFilter{
+		{Process: "shell", Regex: "^(ba|z)?sh$"},
+		{Process: "go", Cmdline: `go (test|build)`},
+		{Process: "binary", Exe: "/usr/(local/)?bin/"},
+		{Process: "root", User: "root", ParentComm: "."},
+		{Process: "system", Cgroup: `\.slice`},
+		{Process: "combined", Regex: ".", User: "0", Cmdline: "-"},
+	}
+	if err := CompileProcessFilters(filters); err != nil {
+		b.Fatal(err)
+	}
+	return filters
+}
+
+func BenchmarkTakeSnapshot(b *testing.B) {
+	startBenchmarkProcesses(b)
+	b.ResetTimer()
+	var processes int
+	for i := 0; i < b.N; i++ {
+		snapshot, err := TakeSnapshot()
+		if err != nil {
+			b.Fatal(err)
+		}
+		processes = snapshot.CountProcesses()
+	}
+	b.ReportMetric(float64(processes), "processes")
+}
+
+// BenchmarkMatchProcesses measures a collection cycle of the filters, the
+// snapshot is taken every iteration because attributes are cached per cycle
+func BenchmarkMatchProcesses(b *testing.B) {
+	startBenchmarkProcesses(b)
+	filters := benchmarkFilters(b)
+	b.ResetTimer()
+	var processes int
+	for i := 0; i < b.N; i++ {
+		snapshot, err := TakeSnapshot()
+		if err != nil {
+			b.Fatal(err)
+		}
+		snapshot.MatchProcesses(filters)
+		processes = snapshot.CountProcesses()
+	}
+	b.ReportMetric(float64(processes), "processes")
+}
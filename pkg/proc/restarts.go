@@ -0,0 +1,45 @@
+package proc
+
+// processID identifies a process across cycles, PIDs are reused so the
+// start time is part of the identity
+type processID struct {
+	pid       int
+	startTime uint64
+}
+
+// RestartTracker counts processes of a group which were not present in the
+// previous cycle, a crash-looping service gets a new PID or start time every
+// time it is restarted
+type RestartTracker struct {
+	previous map[string]map[processID]bool
+}
+
+func NewRestartTracker() *RestartTracker {
+	return &RestartTracker{
+		previous: make(map[string]map[processID]bool),
+	}
+}
+
+// Update returns the number of new processes of every group since the
+// previous call, nothing is counted for a group seen for the first time
+func (t *RestartTracker) Update(groups map[string][]*Process) map[string]int {
+	restarts := make(map[string]int, len(groups))
+	for group, processes := range groups {
+		current := make(map[processID]bool, len(processes))
+		for _, p := range processes {
+			current[processID{pid: p.PID, startTime: p.Stat.Starttime}] = true
+		}
+
+		previous, seen := t.previous[group]
+		restarts[group] = 0
+		if seen {
+			for id := range current {
+				if !previous[id] {
+					restarts[group]++
+				}
+			}
+		}
+		t.previous[group] = current
+	}
+	return restarts
+}
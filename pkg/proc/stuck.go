@@ -0,0 +1,99 @@
+package proc
+
+import (
+	"time"
+)
+
+const (
+	stateZombie       = "Z"
+	stateDiskSleep    = "D"
+	unknownParentComm = "unknown"
+)
+
+// StuckProcesses are zombie and uninterruptible sleep processes grouped by
+// state name and parent comm
+type StuckProcesses struct {
+	Groups []StuckGroup
+	// number of D-state processes by kernel function they wait in, only
+	// filled if requested
+	Wchan map[string]int
+}
+
+type StuckGroup struct {
+	State      string
+	ParentComm string
+	Count      int
+	// longest time a process of the group has been observed in the state
+	OldestAge time.Duration
+}
+
+// StuckTracker remembers when processes were first seen in zombie or D state,
+// the kernel does not record the time of the state change so the age is
+// measured from the first scan which saw the process in the state
+type StuckTracker struct {
+	firstSeen map[stuckID]time.Time
+}
+
+type stuckID struct {
+	processID
+	state string
+}
+
+func NewStuckTracker() *StuckTracker {
+	return &StuckTracker{
+		firstSeen: make(map[stuckID]time.Time),
+	}
+}
+
+func (t *StuckTracker) Update(s *Snapshot, withWchan bool) StuckProcesses {
+	result := StuckProcesses{}
+	if withWchan {
+		result.Wchan = make(map[string]int)
+	}
+
+	firstSeen := make(map[stuckID]time.Time)
+	groups := make(map[[2]string]*StuckGroup)
+	for _, p := range s.Processes {
+		if p.Stat.State != stateZombie && p.Stat.State != stateDiskSleep {
+			continue
+		}
+		id := stuckID{processID: processID{pid: p.PID, startTime: p.Stat.Starttime}, state: p.Stat.State}
+		seen, ok := t.firstSeen[id]
+		if !ok {
+			seen = s.takenAt
+		}
+		firstSeen[id] = seen
+
+		parentComm := s.parentComm(p)
+		if parentComm == "" {
+			parentComm = unknownParentComm
+		}
+		key := [2]string{processTypesMap[p.Stat.State], parentComm}
+		group, ok := groups[key]
+		if !ok {
+			group = &StuckGroup{State: key[0], ParentComm: key[1]}
+			groups[key] = group
+		}
+		group.Count++
+		if age := s.takenAt.Sub(seen); age > group.OldestAge {
+			group.OldestAge = age
+		}
+
+		if withWchan && p.Stat.State == stateDiskSleep {
+			wchan, err := p.proc.Wchan()
+			if err != nil {
+				s.scanError(p.PID, err)
+			}
+			if wchan == "" || wchan == "0" {
+				wchan = "unknown"
+			}
+			result.Wchan[wchan]++
+		}
+	}
+	t.firstSeen = firstSeen
+
+	for _, group := range groups {
+		result.Groups = append(result.Groups, *group)
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package proc
+
+import (
+	"sort"
+	"time"
+)
+
+type TopProcess struct {
+	PID  int
+	Comm string
+	User string
+	// CPU seconds per second since the previous snapshot
+	CPUUsage       float64
+	ResidentMemory uint64
+}
+
+// TopTracker keeps CPU times of the previous snapshot to compute CPU usage
+// of processes between cycles
+type TopTracker struct {
+	previousCPUTime map[processID]float64
+	previousTime    time.Time
+}
+
+func NewTopTracker() *TopTracker {
+	return &TopTracker{
+		previousCPUTime: make(map[processID]float64),
+	}
+}
+
+// Top returns the n processes with the highest CPU usage since the previous
+// call and the n processes with the highest resident memory, CPU usage is
+// not known on the first call and for processes started since the previous call
+func (t *TopTracker) Top(s *Snapshot, n int) ([]TopProcess, []TopProcess) {
+	elapsed := s.takenAt.Sub(t.previousTime).Seconds()
+	cpuTime := make(map[processID]float64, len(s.Processes))
+
+	type candidate struct {
+		process  *Process
+		cpuUsage float64
+	}
+	byCPU := []candidate{}
+	for _, p := range s.Processes {
+		id := processID{pid: p.PID, startTime: p.Stat.Starttime}
+		cpuTime[id] = p.Stat.CPUTime()
+		if previous, ok := t.previousCPUTime[id]; ok && elapsed > 0 {
+			byCPU = append(byCPU, candidate{process: p, cpuUsage: (cpuTime[id] - previous) / elapsed})
+		}
+	}
+	t.previousCPUTime = cpuTime
+	t.previousTime = s.takenAt
+
+	sort.Slice(byCPU, func(i, j int) bool {
+		return byCPU[i].cpuUsage > byCPU[j].cpuUsage
+	})
+	if len(byCPU) > n {
+		byCPU = byCPU[:n]
+	}
+	topCPU := make([]TopProcess, 0, len(byCPU))
+	for _, c := range byCPU {
+		top := newTopProcess(c.process)
+		top.CPUUsage = c.cpuUsage
+		topCPU = append(topCPU, top)
+	}
+
+	byMemory := make([]*Process, len(s.Processes))
+	copy(byMemory, s.Processes)
+	sort.Slice(byMemory, func(i, j int) bool {
+		return byMemory[i].Stat.RSS > byMemory[j].Stat.RSS
+	})
+	if len(byMemory) > n {
+		byMemory = byMemory[:n]
+	}
+	topMemory := make([]TopProcess, 0, len(byMemory))
+	for _, p := range byMemory {
+		topMemory = append(topMemory, newTopProcess(p))
+	}
+
+	return topCPU, topMemory
+}
+
+func newTopProcess(p *Process) TopProcess {
+	return TopProcess{
+		PID:            p.PID,
+		Comm:           p.Stat.Comm,
+		User:           p.User(),
+		ResidentMemory: uint64(p.Stat.ResidentMemory()),
+	}
+}
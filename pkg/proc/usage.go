@@ -0,0 +1,247 @@
+package proc
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// clock ticks per second of utime and stime in /proc/<pid>/stat
+	userHZ = 100
+)
+
+// ProcessUsage is the resource usage of a group of processes, gauges are
+// sums over the processes alive in the current cycle, counters include
+// processes of the group which exited since the tracker was created
+type ProcessUsage struct {
+	Count          int
+	Threads        int
+	CPUTime        float64
+	UserCPUTime    float64
+	SystemCPUTime  float64
+	ResidentMemory uint64
+	MajorFaults    uint64
+	// open file descriptors of all processes and the highest ratio of open
+	// descriptors to RLIMIT_NOFILE of a single process
+	OpenFDs                int
+	MaxFDsUsageRatio       float64
+	ReadBytes              uint64
+	WriteBytes             uint64
+	VoluntaryCtxSwitches   uint64
+	InvoluntaryCtxSwitches uint64
+	// start times in seconds since the epoch, 0 without processes
+	OldestStartTime float64
+	NewestStartTime float64
+}
+
+// processCounters are the cumulative counters of a single process, io and
+// context switches are not readable for every process
+type processCounters struct {
+	cpuTime                float64
+	userCPUTime            float64
+	systemCPUTime          float64
+	majorFaults            uint64
+	readBytes              uint64
+	writeBytes             uint64
+	voluntaryCtxSwitches   uint64
+	involuntaryCtxSwitches uint64
+	hasIO                  bool
+	hasStatus              bool
+}
+
+func (c *processCounters) add(other processCounters) {
+	c.cpuTime += other.cpuTime
+	c.userCPUTime += other.userCPUTime
+	c.systemCPUTime += other.systemCPUTime
+	c.majorFaults += other.majorFaults
+	c.readBytes += other.readBytes
+	c.writeBytes += other.writeBytes
+	c.voluntaryCtxSwitches += other.voluntaryCtxSwitches
+	c.involuntaryCtxSwitches += other.involuntaryCtxSwitches
+}
+
+// UsageTracker keeps the last counters of the processes of every group so
+// the counters of a group do not decrease when one of its processes exits,
+// which rate() would read as a counter reset
+type UsageTracker struct {
+	groups map[string]*groupCounters
+}
+
+type groupCounters struct {
+	// counters of processes which left the group
+	exited processCounters
+	alive  map[processID]processCounters
+}
+
+func NewUsageTracker() *UsageTracker {
+	return &UsageTracker{
+		groups: make(map[string]*groupCounters),
+	}
+}
+
+// Update returns the resource usage of the processes of the group, values
+// which can not be read (e.g. io of processes of other users) are skipped,
+// counters of a process which could be read earlier are carried forward
+func (t *UsageTracker) Update(group string, processes []*Process) ProcessUsage {
+	counters, ok := t.groups[group]
+	if !ok {
+		counters = &groupCounters{}
+		t.groups[group] = counters
+	}
+
+	usage := ProcessUsage{Count: len(processes)}
+	alive := make(map[processID]processCounters, len(processes))
+	for _, p := range processes {
+		id := processID{pid: p.PID, startTime: p.Stat.Starttime}
+		current := processUsage(p, &usage)
+		if previous, ok := counters.alive[id]; ok {
+			if !current.hasIO && previous.hasIO {
+				current.readBytes, current.writeBytes, current.hasIO = previous.readBytes, previous.writeBytes, true
+			}
+			if !current.hasStatus && previous.hasStatus {
+				current.voluntaryCtxSwitches, current.involuntaryCtxSwitches, current.hasStatus = previous.voluntaryCtxSwitches, previous.involuntaryCtxSwitches, true
+			}
+		}
+		alive[id] = current
+	}
+	for id, previous := range counters.alive {
+		if _, ok := alive[id]; !ok {
+			counters.exited.add(previous)
+		}
+	}
+	counters.alive = alive
+
+	total := counters.exited
+	for _, c := range alive {
+		total.add(c)
+	}
+	usage.CPUTime = total.cpuTime
+	usage.UserCPUTime = total.userCPUTime
+	usage.SystemCPUTime = total.systemCPUTime
+	usage.MajorFaults = total.majorFaults
+	usage.ReadBytes = total.readBytes
+	usage.WriteBytes = total.writeBytes
+	usage.VoluntaryCtxSwitches = total.voluntaryCtxSwitches
+	usage.InvoluntaryCtxSwitches = total.involuntaryCtxSwitches
+	return usage
+}
+
+// processUsage adds the gauges of the process to the usage and returns its
+// counters
+func processUsage(p *Process, usage *ProcessUsage) processCounters {
+	counters := processCounters{
+		cpuTime:       p.Stat.CPUTime(),
+		userCPUTime:   float64(p.Stat.UTime) / userHZ,
+		systemCPUTime: float64(p.Stat.STime) / userHZ,
+		majorFaults:   uint64(p.Stat.MajFlt),
+	}
+	usage.Threads += p.Stat.NumThreads
+	usage.ResidentMemory += uint64(p.Stat.ResidentMemory())
+
+	startTime := p.StartTime()
+	if usage.OldestStartTime == 0 || startTime < usage.OldestStartTime {
+		usage.OldestStartTime = startTime
+	}
+	if startTime > usage.NewestStartTime {
+		usage.NewestStartTime = startTime
+	}
+
+	if status, ok := p.Status(); ok {
+		counters.voluntaryCtxSwitches = status.VoluntaryCtxtSwitches
+		counters.involuntaryCtxSwitches = status.NonVoluntaryCtxtSwitches
+		counters.hasStatus = true
+	}
+
+	if io, err := p.proc.IO(); err == nil {
+		counters.readBytes = io.ReadBytes
+		counters.writeBytes = io.WriteBytes
+		counters.hasIO = true
+	} else {
+		p.snapshot.scanError(p.PID, err)
+	}
+
+	fds, err := p.proc.FileDescriptorsLen()
+	if err != nil {
+		p.snapshot.scanError(p.PID, err)
+		return counters
+	}
+	usage.OpenFDs += fds
+	limits, err := p.proc.Limits()
+	if err != nil {
+		p.snapshot.scanError(p.PID, err)
+		return counters
+	}
+	if limits.OpenFiles > 0 && limits.OpenFiles != math.MaxUint64 {
+		usage.MaxFDsUsageRatio = math.Max(usage.MaxFDsUsageRatio, float64(fds)/float64(limits.OpenFiles))
+	}
+	return counters
+}
+
+// ProcessMemory is the memory of a group of processes from smaps_rollup in bytes
+type ProcessMemory struct {
+	// proportional set size, shared pages are divided between the processes
+	// sharing them
+	PSS uint64
+	// unique set size, pages private to the processes
+	USS    uint64
+	Shared uint64
+	Swap   uint64
+}
+
+// AggregateMemory sums smaps_rollup of the processes, processes which can
+// not be read are skipped
+func AggregateMemory(processes []*Process) ProcessMemory {
+	memory := ProcessMemory{}
+	for _, p := range processes {
+		smaps, err := p.proc.ProcSMapsRollup()
+		if err != nil {
+			p.snapshot.scanError(p.PID, err)
+			continue
+		}
+		memory.PSS += smaps.Pss
+		memory.USS += smaps.PrivateClean + smaps.PrivateDirty
+		memory.Shared += smaps.SharedClean + smaps.SharedDirty
+		memory.Swap += smaps.Swap
+	}
+	return memory
+}
+
+// ProcessSample is the resource usage of a single process
+type ProcessSample struct {
+	PID            int
+	Cmdline        string
+	CPUTime        float64
+	ResidentMemory uint64
+	Threads        int
+	StartTime      float64
+}
+
+// SampleProcesses returns samples of at most limit processes with the highest
+// resident memory
+func SampleProcesses(processes []*Process, limit int) []ProcessSample {
+	sorted := make([]*Process, len(processes))
+	copy(sorted, processes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Stat.RSS > sorted[j].Stat.RSS
+	})
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	samples := make([]ProcessSample, 0, len(sorted))
+	for _, p := range sorted {
+		cmdline := p.Cmdline()
+		if cmdline == "" {
+			cmdline = p.Stat.Comm
+		}
+		samples = append(samples, ProcessSample{
+			PID:            p.PID,
+			Cmdline:        cmdline,
+			CPUTime:        p.Stat.CPUTime(),
+			ResidentMemory: uint64(p.Stat.ResidentMemory()),
+			Threads:        p.Stat.NumThreads,
+			StartTime:      p.StartTime(),
+		})
+	}
+	return samples
+}
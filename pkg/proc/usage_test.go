@@ -0,0 +1,38 @@
+package proc
+
+import (
+	"os"
+	"testing"
+)
+
+func TestUsageTrackerKeepsCountersOfExitedProcesses(t *testing.T) {
+	snapshot, err := TakeSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	self, ok := snapshot.byPID[os.Getpid()]
+	if !ok {
+		t.Fatal("test process is not in the snapshot")
+	}
+
+	tracker := NewUsageTracker()
+	alive := tracker.Update("test", []*Process{self})
+	if alive.Count != 1 || alive.Threads == 0 {
+		t.Fatalf("got usage %+v with the test process", alive)
+	}
+
+	// the process left the group, its counters are carried forward
+	exited := tracker.Update("test", nil)
+	if exited.Count != 0 || exited.Threads != 0 || exited.ResidentMemory != 0 {
+		t.Errorf("got gauges %+v without processes", exited)
+	}
+	if exited.CPUTime != alive.CPUTime || exited.MajorFaults != alive.MajorFaults ||
+		exited.ReadBytes != alive.ReadBytes || exited.VoluntaryCtxSwitches != alive.VoluntaryCtxSwitches {
+		t.Errorf("got counters %+v after the process exited, expected those of %+v", exited, alive)
+	}
+
+	// counters of other groups are not affected
+	if other := tracker.Update("other", nil); other.CPUTime != 0 {
+		t.Errorf("got cpu time %v of an empty group", other.CPUTime)
+	}
+}
@@ -0,0 +1,209 @@
+package sockets
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/procfs"
+)
+
+const (
+	// socket states from include/net/tcp_states.h
+	tcpListen = 0x0a
+	tcpClose  = 0x07
+)
+
+type ExpectedListener struct {
+	Addr    string `yaml:"addr"`
+	Port    uint16 `yaml:"port"`
+	Proto   string `yaml:"proto"`
+	Process string `yaml:"process"`
+
+	// compiled by ValidateExpectedListeners, nil if the process is not set
+	process *regexp.Regexp
+}
+
+type Listener struct {
+	Addr    string
+	Port    uint16
+	Proto   string
+	Process string
+	inode   uint64
+}
+
+type ExpectedListenerResult struct {
+	ExpectedListener
+	Found bool
+}
+
+// ValidateExpectedListeners checks protocols of the expected listeners and
+// compiles their process regexes in place
+func ValidateExpectedListeners(expected []ExpectedListener) error {
+	for i := range expected {
+		e := &expected[i]
+		e.Proto = strings.ToLower(e.Proto)
+		switch e.Proto {
+		case "tcp", "tcp6", "udp", "udp6":
+		default:
+			return fmt.Errorf("unknown proto: %q of expected listener on port %d", e.Proto, e.Port)
+		}
+		if e.Addr != "" && net.ParseIP(e.Addr) == nil {
+			return fmt.Errorf("invalid addr: %q of expected listener on port %d", e.Addr, e.Port)
+		}
+		if e.Port == 0 {
+			return fmt.Errorf("port is required for expected listener with proto %s", e.Proto)
+		}
+		if e.Process != "" {
+			re, err := regexp.Compile(e.Process)
+			if err != nil {
+				return fmt.Errorf("invalid process regex of expected listener %s/%d: %v", e.Proto, e.Port, err)
+			}
+			e.process = re
+		}
+	}
+	return nil
+}
+
+// FindListeners returns listening TCP sockets and unconnected UDP sockets with
+// the names of the processes owning them
+func FindListeners() ([]Listener, error) {
+	fs, err := procfs.NewDefaultFS()
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []struct {
+		proto string
+		read  func() (procfs.NetIPSocket, error)
+	}{
+		{"tcp", func() (procfs.NetIPSocket, error) { lines, err := fs.NetTCP(); return procfs.NetIPSocket(lines), err }},
+		{"tcp6", func() (procfs.NetIPSocket, error) { lines, err := fs.NetTCP6(); return procfs.NetIPSocket(lines), err }},
+		{"udp", func() (procfs.NetIPSocket, error) { lines, err := fs.NetUDP(); return procfs.NetIPSocket(lines), err }},
+		{"udp6", func() (procfs.NetIPSocket, error) { lines, err := fs.NetUDP6(); return procfs.NetIPSocket(lines), err }},
+	}
+
+	var listeners []Listener
+	for _, table := range tables {
+		lines, err := table.read()
+		if err != nil {
+			// tcp6 and udp6 are missing if IPv6 is disabled
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("read /proc/net/%s: %w", table.proto, err)
+		}
+		for _, line := range lines {
+			if !isListening(table.proto, line.St, line.RemPort) {
+				continue
+			}
+			listeners = append(listeners, Listener{
+				Addr:  line.LocalAddr.String(),
+				Port:  uint16(line.LocalPort),
+				Proto: table.proto,
+				inode: line.Inode,
+			})
+		}
+	}
+
+	owners := socketOwners(fs)
+	for i := range listeners {
+		listeners[i].Process = owners[listeners[i].inode]
+	}
+	return listeners, nil
+}
+
+// isListening returns true for TCP sockets in the LISTEN state and for UDP
+// sockets without a remote peer
+func isListening(proto string, state uint64, remotePort uint64) bool {
+	if strings.HasPrefix(proto, "tcp") {
+		return state == tcpListen
+	}
+	return state == tcpClose && remotePort == 0
+}
+
+// socketOwners maps socket inodes to the comm of the process with the lowest
+// PID holding the socket, processes which can not be read are skipped
+func socketOwners(fs procfs.FS) map[uint64]string {
+	owners := make(map[uint64]string)
+	procs, err := fs.AllProcs()
+	if err != nil {
+		return owners
+	}
+	for _, p := range procs {
+		targets, err := p.FileDescriptorTargets()
+		if err != nil {
+			continue
+		}
+		var comm string
+		for _, target := range targets {
+			if !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+			if _, exists := owners[inode]; exists {
+				continue
+			}
+			if comm == "" {
+				if comm, err = p.Comm(); err != nil {
+					break
+				}
+			}
+			owners[inode] = comm
+		}
+	}
+	return owners
+}
+
+// MatchExpectedListeners reports for every expected listener whether it is
+// present and returns the listeners not matching any expected entry, without
+// expected listeners nothing is reported as unexpected
+func MatchExpectedListeners(listeners []Listener, expected []ExpectedListener) ([]ExpectedListenerResult, []Listener) {
+	if len(expected) == 0 {
+		return nil, nil
+	}
+	results := make([]ExpectedListenerResult, len(expected))
+	matched := make([]bool, len(listeners))
+	for i, e := range expected {
+		results[i].ExpectedListener = e
+		for j, l := range listeners {
+			if e.matches(l) {
+				results[i].Found = true
+				matched[j] = true
+			}
+		}
+	}
+
+	var unexpected []Listener
+	for j, l := range listeners {
+		if !matched[j] {
+			unexpected = append(unexpected, l)
+		}
+	}
+	return results, unexpected
+}
+
+// matches compares the listener with the expected one, an empty addr matches
+// any address and proto tcp or udp matches both address families
+func (e ExpectedListener) matches(l Listener) bool {
+	if e.Port != l.Port {
+		return false
+	}
+	if e.Proto != l.Proto && e.Proto != strings.TrimSuffix(l.Proto, "6") {
+		return false
+	}
+	if e.Addr != "" && !net.ParseIP(e.Addr).Equal(net.ParseIP(l.Addr)) {
+		return false
+	}
+	if e.process != nil && !e.process.MatchString(l.Process) {
+		return false
+	}
+	return true
+}
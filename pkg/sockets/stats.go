@@ -0,0 +1,175 @@
+package sockets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/procfs"
+)
+
+const (
+	conntrackCountPath = "/proc/sys/net/netfilter/nf_conntrack_count"
+	conntrackMaxPath   = "/proc/sys/net/netfilter/nf_conntrack_max"
+)
+
+var (
+	// TCP states from include/net/tcp_states.h
+	tcpStates = map[uint64]string{
+		0x01: "established",
+		0x02: "syn_sent",
+		0x03: "syn_recv",
+		0x04: "fin_wait1",
+		0x05: "fin_wait2",
+		0x06: "time_wait",
+		0x07: "close",
+		0x08: "close_wait",
+		0x09: "last_ack",
+		0x0a: "listen",
+		0x0b: "closing",
+		0x0c: "new_syn_recv",
+	}
+)
+
+type TCPStats struct {
+	// number of sockets by state
+	States map[string]int
+	// number of sockets by configured port and state
+	LocalPorts  map[uint16]map[string]int
+	RemotePorts map[uint16]map[string]int
+}
+
+type SockstatValue struct {
+	Protocol string
+	Type     string
+	Value    int
+}
+
+type Conntrack struct {
+	Count int
+	Max   int
+}
+
+func newStateCounts() map[string]int {
+	counts := make(map[string]int, len(tcpStates))
+	for _, state := range tcpStates {
+		counts[state] = 0
+	}
+	return counts
+}
+
+// CountTCPStates counts IPv4 and IPv6 TCP sockets by state, sockets of the
+// given local and remote ports are counted separately as well
+func CountTCPStates(localPorts []uint16, remotePorts []uint16) (TCPStats, error) {
+	stats := TCPStats{
+		States:      newStateCounts(),
+		LocalPorts:  make(map[uint16]map[string]int),
+		RemotePorts: make(map[uint16]map[string]int),
+	}
+	for _, port := range localPorts {
+		stats.LocalPorts[port] = newStateCounts()
+	}
+	for _, port := range remotePorts {
+		stats.RemotePorts[port] = newStateCounts()
+	}
+
+	fs, err := procfs.NewDefaultFS()
+	if err != nil {
+		return stats, err
+	}
+	for _, read := range []func() (procfs.NetTCP, error){fs.NetTCP, fs.NetTCP6} {
+		lines, err := read()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return stats, err
+		}
+		for _, line := range lines {
+			state, ok := tcpStates[line.St]
+			if !ok {
+				continue
+			}
+			stats.States[state]++
+			if counts, ok := stats.LocalPorts[uint16(line.LocalPort)]; ok {
+				counts[state]++
+			}
+			if counts, ok := stats.RemotePorts[uint16(line.RemPort)]; ok {
+				counts[state]++
+			}
+		}
+	}
+	return stats, nil
+}
+
+// ReadSockstat returns socket usage from /proc/net/sockstat and
+// /proc/net/sockstat6, mem values are in pages
+func ReadSockstat() ([]SockstatValue, error) {
+	fs, err := procfs.NewDefaultFS()
+	if err != nil {
+		return nil, err
+	}
+
+	var values []SockstatValue
+	for _, read := range []func() (*procfs.NetSockstat, error){fs.NetSockstat, fs.NetSockstat6} {
+		stat, err := read()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		if stat.Used != nil {
+			values = append(values, SockstatValue{Protocol: "sockets", Type: "used", Value: *stat.Used})
+		}
+		for _, p := range stat.Protocols {
+			values = append(values, SockstatValue{Protocol: p.Protocol, Type: "inuse", Value: p.InUse})
+			for _, v := range []struct {
+				name  string
+				value *int
+			}{
+				{"orphan", p.Orphan},
+				{"tw", p.TW},
+				{"alloc", p.Alloc},
+				{"mem", p.Mem},
+				{"memory", p.Memory},
+			} {
+				if v.value != nil {
+					values = append(values, SockstatValue{Protocol: p.Protocol, Type: v.name, Value: *v.value})
+				}
+			}
+		}
+	}
+	return values, nil
+}
+
+// ReadConntrack returns usage of the conntrack table, nil if the
+// nf_conntrack module is not loaded
+func ReadConntrack() (*Conntrack, error) {
+	count, err := readIntFile(conntrackCountPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	max, err := readIntFile(conntrackMaxPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Conntrack{Count: count, Max: max}, nil
+}
+
+func readIntFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,92 @@
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	// os-release locations in the order of precedence, see os-release(5)
+	osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+)
+
+type OSInfo struct {
+	ID       string
+	Version  string
+	Codename string
+}
+
+type KernelInfo struct {
+	Release string
+	Version string
+	Machine string
+}
+
+// ReadOSInfo returns ID, VERSION_ID and VERSION_CODENAME from os-release
+func ReadOSInfo() (OSInfo, error) {
+	for _, path := range osReleasePaths {
+		file, err := os.Open(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return OSInfo{}, fmt.Errorf("failed to read os-release: %w", err)
+		}
+		defer file.Close()
+		return parseOSRelease(bufio.NewScanner(file))
+	}
+	return OSInfo{}, fmt.Errorf("os-release not found in %s", strings.Join(osReleasePaths, ", "))
+}
+
+func parseOSRelease(scanner *bufio.Scanner) (OSInfo, error) {
+	info := OSInfo{}
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		switch key {
+		case "ID":
+			info.ID = value
+		case "VERSION_ID":
+			info.Version = value
+		case "VERSION_CODENAME":
+			info.Codename = value
+		}
+	}
+	return info, scanner.Err()
+}
+
+// ReadKernelInfo returns the kernel release, version and machine from the
+// uname syscall
+func ReadKernelInfo() (KernelInfo, error) {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return KernelInfo{}, fmt.Errorf("uname: %w", err)
+	}
+	return KernelInfo{
+		Release: utsnameString(uname.Release[:]),
+		Version: utsnameString(uname.Version[:]),
+		Machine: utsnameString(uname.Machine[:]),
+	}, nil
+}
+
+func utsnameString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"hash/crc32"
 	"os"
+	"os/exec"
 	"strconv"
 	"strings"
-	"os/exec"
+
+	"golang.org/x/sys/unix"
 )
 
 
@@ -43,30 +45,29 @@ func UptimeInSeconds() (float64, error) {
 	return uptimeSeconds, nil
 }
 
-func CountLoginUsers() (int, error) {
-	output, err := exec.Command("who", "-q").Output()
-	if err != nil {
-		return 0, fmt.Errorf("failed to execute 'who -q': %w", err)
-	}
-	usersLine := strings.TrimSpace(string(output))
-	usersField := strings.Split(usersLine, "=")
-	if len(usersField) != 2 {
-		return 0, fmt.Errorf("invalid format in 'who -q' output")
-	}
-	numUsers, err := strconv.Atoi(usersField[1])
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse number of users: %w", err)
-	}
-	return numUsers, nil
-}
-
+// UnameChecksum returns the checksum of the uname -a output. The output
+// depends on the uname implementation (RHEL prints the processor and the
+// hardware platform, busybox prints a different operating system name), it
+// is hashed as is so the value stays the same as before. Without the uname
+// command, e.g. in a minimal container, the line is built from the uname
+// syscall in the format of GNU coreutils.
 func UnameChecksum() (float64, error) {
 	output, err := exec.Command("uname", "-a").Output()
 	if err != nil {
-		return 0, fmt.Errorf("failed to execute 'uname -a': %w", err)
+		var uname unix.Utsname
+		if err := unix.Uname(&uname); err != nil {
+			return 0, fmt.Errorf("uname: %w", err)
+		}
+		output = []byte(fmt.Sprintf("%s %s %s %s %s GNU/Linux\n",
+			utsnameString(uname.Sysname[:]),
+			utsnameString(uname.Nodename[:]),
+			utsnameString(uname.Release[:]),
+			utsnameString(uname.Version[:]),
+			utsnameString(uname.Machine[:]),
+		))
 	}
 	tablePolynomial := crc32.MakeTable(crc32.IEEE)
-	hash := crc32.Checksum([]byte(output), tablePolynomial)
+	hash := crc32.Checksum(output, tablePolynomial)
 
 	return float64(hash), nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,199 @@
+package system
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// created by update-notifier and unattended-upgrades on Debian and Ubuntu
+	rebootRequiredPath     = "/var/run/reboot-required"
+	rebootRequiredPkgsPath = "/var/run/reboot-required.pkgs"
+
+	bootPath    = "/boot"
+	modulesPath = "/lib/modules"
+)
+
+type RebootRequired struct {
+	Required bool
+	// number of packages which requested the reboot
+	Packages int
+}
+
+// CheckRebootRequired checks the reboot-required flag file and counts the
+// packages listed in reboot-required.pkgs
+func CheckRebootRequired() (RebootRequired, error) {
+	result := RebootRequired{}
+	if _, err := os.Stat(rebootRequiredPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return result, nil
+		}
+		return result, fmt.Errorf("failed to check %s: %w", rebootRequiredPath, err)
+	}
+	result.Required = true
+
+	file, err := os.Open(rebootRequiredPkgsPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return result, nil
+		}
+		return result, fmt.Errorf("failed to read %s: %w", rebootRequiredPkgsPath, err)
+	}
+	defer file.Close()
+
+	packages := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			packages[name] = true
+		}
+	}
+	result.Packages = len(packages)
+	return result, scanner.Err()
+}
+
+// NewestInstalledKernel returns the newest kernel release of the flavor with
+// an image in /boot or modules in /lib/modules, empty if no kernel is found
+func NewestInstalledKernel(flavor string) (string, error) {
+	var releases []string
+
+	images, err := filepath.Glob(filepath.Join(bootPath, "vmlinuz-*"))
+	if err != nil {
+		return "", err
+	}
+	for _, image := range images {
+		releases = append(releases, strings.TrimPrefix(filepath.Base(image), "vmlinuz-"))
+	}
+
+	entries, err := os.ReadDir(modulesPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to read %s: %w", modulesPath, err)
+	}
+	for _, entry := range entries {
+		// directories of removed kernels may still contain dkms modules
+		if _, err := os.Stat(filepath.Join(modulesPath, entry.Name(), "modules.dep")); err == nil {
+			releases = append(releases, entry.Name())
+		}
+	}
+
+	return newestRelease(releases, flavor), nil
+}
+
+// KernelOutdated compares the running kernel release with the newest installed
+// one of the same flavor, the newest release is empty if no installed kernel
+// is found
+func KernelOutdated(runningRelease string) (bool, string, error) {
+	newest, err := NewestInstalledKernel(kernelFlavor(runningRelease))
+	if err != nil || newest == "" {
+		return false, newest, err
+	}
+	return compareVersions(newest, runningRelease) > 0, newest, nil
+}
+
+// newestRelease returns the newest of the releases of the flavor, kernels of
+// other flavors (lowlatency and generic, cloud-amd64 and amd64) are installed
+// side by side and are not upgrades of each other
+func newestRelease(releases []string, flavor string) string {
+	newest := ""
+	for _, release := range releases {
+		if kernelFlavor(release) != flavor {
+			continue
+		}
+		if newest == "" || compareVersions(release, newest) > 0 {
+			newest = release
+		}
+	}
+	return newest
+}
+
+// kernelFlavor returns the part of a kernel release which is not a version:
+// amd64 of Debian 6.1.0-21-amd64 and 6.1.0-0.deb11.17-amd64, generic of
+// Ubuntu 5.15.0-105-generic, the architecture and the variant of RHEL
+// 5.14.0-362.8.1.el9_3.x86_64+debug
+func kernelFlavor(release string) string {
+	release, variant, _ := strings.Cut(release, "+")
+	fields := strings.Split(release, "-")[1:]
+	var words []string
+	for _, field := range fields {
+		// ABI numbers like 21 and package revisions like 0.deb11.17
+		if field == "" || unicode.IsDigit(rune(field[0])) && (strings.Contains(field, ".") || strings.TrimLeft(field, "0123456789") == "") {
+			continue
+		}
+		words = append(words, field)
+	}
+	// RHEL and Fedora append the distribution and the architecture to the
+	// package release with dots
+	if len(words) == 0 && len(fields) == 1 {
+		if i := strings.LastIndex(fields[0], "."); i >= 0 && i+1 < len(fields[0]) && !unicode.IsDigit(rune(fields[0][i+1])) {
+			words = append(words, fields[0][i+1:])
+		}
+	}
+	flavor := strings.Join(words, "-")
+	if variant != "" {
+		flavor += "+" + variant
+	}
+	return flavor
+}
+
+// compareVersions compares kernel releases like 6.1.0-21-amd64 or
+// 5.14.0-362.8.1.el9_3.x86_64 by numeric and non-numeric parts
+func compareVersions(a string, b string) int {
+	partsA, partsB := versionParts(a), versionParts(b)
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		numberA, errA := strconv.ParseUint(partsA[i], 10, 64)
+		numberB, errB := strconv.ParseUint(partsB[i], 10, 64)
+		switch {
+		case errA == nil && errB == nil:
+			if numberA != numberB {
+				if numberA > numberB {
+					return 1
+				}
+				return -1
+			}
+		case errA == nil:
+			// numeric parts are newer than suffixes like rc
+			return 1
+		case errB == nil:
+			return -1
+		default:
+			if c := strings.Compare(partsA[i], partsB[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(partsA) - len(partsB)
+}
+
+// versionParts splits a version into runs of digits and runs of letters,
+// separators are dropped
+func versionParts(version string) []string {
+	var parts []string
+	current := []rune{}
+	isDigit := false
+	for _, r := range version {
+		if !unicode.IsDigit(r) && !unicode.IsLetter(r) {
+			if len(current) > 0 {
+				parts = append(parts, string(current))
+				current = current[:0]
+			}
+			continue
+		}
+		if len(current) > 0 && unicode.IsDigit(r) != isDigit {
+			parts = append(parts, string(current))
+			current = current[:0]
+		}
+		isDigit = unicode.IsDigit(r)
+		current = append(current, r)
+	}
+	if len(current) > 0 {
+		parts = append(parts, string(current))
+	}
+	return parts
+}
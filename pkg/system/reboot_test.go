@@ -0,0 +1,119 @@
+package system
+
+import (
+	"testing"
+)
+
+func TestKernelFlavor(t *testing.T) {
+	for _, tc := range []struct {
+		release string
+		flavor  string
+	}{
+		// Debian
+		{"6.1.0-21-amd64", "amd64"},
+		{"6.1.0-21-cloud-amd64", "cloud-amd64"},
+		{"6.1.0-21-rt-amd64", "rt-amd64"},
+		{"6.1.0-0.deb11.17-amd64", "amd64"},
+		{"5.10.0-28-arm64", "arm64"},
+		// Ubuntu
+		{"5.15.0-105-generic", "generic"},
+		{"5.15.0-105-lowlatency", "lowlatency"},
+		{"6.5.0-1020-aws", "aws"},
+		{"6.8.0-31-generic-64k", "generic-64k"},
+		// RHEL and Fedora
+		{"5.14.0-362.8.1.el9_3.x86_64", "x86_64"},
+		{"4.18.0-553.el8_10.x86_64", "x86_64"},
+		{"5.14.0-362.8.1.el9_3.x86_64+debug", "x86_64+debug"},
+		{"5.14.0-427.13.1.el9_4.aarch64", "aarch64"},
+		{"6.8.9-300.fc40.x86_64", "x86_64"},
+		// SUSE and vanilla kernels
+		{"5.14.21-150500.55.39-default", "default"},
+		{"6.9.0", ""},
+	} {
+		if flavor := kernelFlavor(tc.release); flavor != tc.flavor {
+			t.Errorf("kernelFlavor(%q) = %q, expected %q", tc.release, flavor, tc.flavor)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a      string
+		b      string
+		result int
+	}{
+		{"6.1.0-21-amd64", "6.1.0-21-amd64", 0},
+		{"6.1.0-22-amd64", "6.1.0-21-amd64", 1},
+		{"6.1.0-9-amd64", "6.1.0-21-amd64", -1},
+		{"6.1.0-21-amd64", "5.10.0-28-amd64", 1},
+		{"5.15.0-105-generic", "5.15.0-97-generic", 1},
+		{"6.5.0-1020-aws", "6.5.0-1018-aws", 1},
+		{"5.14.0-362.8.1.el9_3.x86_64", "5.14.0-362.24.1.el9_3.x86_64", -1},
+		{"5.14.0-427.13.1.el9_4.x86_64", "5.14.0-362.24.1.el9_3.x86_64", 1},
+		{"4.18.0-553.el8_10.x86_64", "4.18.0-513.24.1.el8_9.x86_64", 1},
+	} {
+		if result := compareVersions(tc.a, tc.b); sign(result) != tc.result {
+			t.Errorf("compareVersions(%q, %q) = %d, expected %d", tc.a, tc.b, result, tc.result)
+		}
+	}
+}
+
+func TestNewestRelease(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		running  string
+		releases []string
+		newest   string
+	}{
+		{
+			name:     "debian upgrade",
+			running:  "6.1.0-18-amd64",
+			releases: []string{"6.1.0-18-amd64", "6.1.0-21-amd64"},
+			newest:   "6.1.0-21-amd64",
+		},
+		{
+			name:     "debian cloud kernel is not an upgrade of the generic one",
+			running:  "6.1.0-21-amd64",
+			releases: []string{"6.1.0-21-amd64", "6.1.0-21-cloud-amd64", "6.1.0-22-cloud-amd64"},
+			newest:   "6.1.0-21-amd64",
+		},
+		{
+			name:     "ubuntu lowlatency kernel is not an upgrade of the generic one",
+			running:  "5.15.0-105-generic",
+			releases: []string{"5.15.0-105-generic", "5.15.0-105-lowlatency"},
+			newest:   "5.15.0-105-generic",
+		},
+		{
+			name:     "ubuntu upgrade",
+			running:  "5.15.0-97-generic",
+			releases: []string{"5.15.0-97-generic", "5.15.0-105-generic", "5.15.0-107-lowlatency"},
+			newest:   "5.15.0-105-generic",
+		},
+		{
+			name:     "rhel upgrade across minor releases",
+			running:  "5.14.0-362.24.1.el9_3.x86_64",
+			releases: []string{"5.14.0-362.24.1.el9_3.x86_64", "5.14.0-427.13.1.el9_4.x86_64", "5.14.0-427.13.1.el9_4.x86_64+debug"},
+			newest:   "5.14.0-427.13.1.el9_4.x86_64",
+		},
+		{
+			name:     "no kernel of the flavor",
+			running:  "6.1.0-21-amd64",
+			releases: []string{"6.1.0-21-cloud-amd64"},
+			newest:   "",
+		},
+	} {
+		if newest := newestRelease(tc.releases, kernelFlavor(tc.running)); newest != tc.newest {
+			t.Errorf("%s: newestRelease = %q, expected %q", tc.name, newest, tc.newest)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+package system
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultUtmpPath = "/var/run/utmp"
+
+	// size of struct utmp of glibc on Linux, the same on 32 and 64 bit
+	// architectures
+	utmpRecordSize = 384
+	// ut_type of a normal login session
+	utmpUserProcess = 7
+
+	utmpLineOffset = 8
+	utmpLineSize   = 32
+	utmpUserOffset = 44
+	utmpUserSize   = 32
+	utmpHostOffset = 76
+	utmpHostSize   = 256
+	utmpTimeOffset = 340
+)
+
+type LoginSession struct {
+	User string
+	// terminal without the /dev/ prefix, e.g. pts/0 or tty1
+	Line string
+	// remote host for remote logins, empty for local ones
+	Host      string
+	LoginTime time.Time
+}
+
+// TTYType returns pts, tty, console or other by the terminal of the session
+func (s LoginSession) TTYType() string {
+	switch {
+	case strings.HasPrefix(s.Line, "pts/"):
+		return "pts"
+	case s.Line == "console":
+		return "console"
+	case strings.HasPrefix(s.Line, "tty"):
+		return "tty"
+	}
+	return "other"
+}
+
+// ReadLoginSessions returns login sessions from the utmp file, a missing file
+// means there are no sessions
+func ReadLoginSessions(path string) ([]LoginSession, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read utmp file: %w", err)
+	}
+	if len(data)%utmpRecordSize != 0 {
+		return nil, fmt.Errorf("invalid size of utmp file %s: %d is not a multiple of %d", path, len(data), utmpRecordSize)
+	}
+
+	var sessions []LoginSession
+	for offset := 0; offset < len(data); offset += utmpRecordSize {
+		record := data[offset : offset+utmpRecordSize]
+		if binary.NativeEndian.Uint16(record[0:2]) != utmpUserProcess {
+			continue
+		}
+		seconds := int32(binary.NativeEndian.Uint32(record[utmpTimeOffset : utmpTimeOffset+4]))
+		sessions = append(sessions, LoginSession{
+			User:      cString(record[utmpUserOffset : utmpUserOffset+utmpUserSize]),
+			Line:      cString(record[utmpLineOffset : utmpLineOffset+utmpLineSize]),
+			Host:      cString(record[utmpHostOffset : utmpHostOffset+utmpHostSize]),
+			LoginTime: time.Unix(int64(seconds), 0),
+		})
+	}
+	return sessions, nil
+}
+
+// cString returns the string of a NUL padded field
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,77 @@
+package system
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// utmpRecord builds a struct utmp record with the fields read by ReadLoginSessions
+func utmpRecord(recordType uint16, line string, user string, host string, loginTime int32) []byte {
+	record := make([]byte, utmpRecordSize)
+	binary.NativeEndian.PutUint16(record[0:2], recordType)
+	copy(record[utmpLineOffset:utmpLineOffset+utmpLineSize], line)
+	copy(record[utmpUserOffset:utmpUserOffset+utmpUserSize], user)
+	copy(record[utmpHostOffset:utmpHostOffset+utmpHostSize], host)
+	binary.NativeEndian.PutUint32(record[utmpTimeOffset:utmpTimeOffset+4], uint32(loginTime))
+	return record
+}
+
+func TestReadLoginSessions(t *testing.T) {
+	var data []byte
+	// boot time record
+	data = append(data, utmpRecord(2, "~", "reboot", "6.1.0-21-amd64", 1700000000)...)
+	data = append(data, utmpRecord(utmpUserProcess, "pts/0", "alice", "192.0.2.10", 1700000100)...)
+	data = append(data, utmpRecord(utmpUserProcess, "tty1", "root", "", 1700000200)...)
+	data = append(data, utmpRecord(utmpUserProcess, "pts/1", "bob", "host\xff.example.com", 1700000300)...)
+	// dead process of a closed session
+	data = append(data, utmpRecord(8, "pts/2", "", "", 1700000400)...)
+
+	path := filepath.Join(t.TempDir(), "utmp")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := ReadLoginSessions(path)
+	if err != nil {
+		t.Fatalf("ReadLoginSessions: %v", err)
+	}
+	expected := []LoginSession{
+		{User: "alice", Line: "pts/0", Host: "192.0.2.10", LoginTime: time.Unix(1700000100, 0)},
+		{User: "root", Line: "tty1", Host: "", LoginTime: time.Unix(1700000200, 0)},
+		{User: "bob", Line: "pts/1", Host: "host\xff.example.com", LoginTime: time.Unix(1700000300, 0)},
+	}
+	if len(sessions) != len(expected) {
+		t.Fatalf("got %d sessions, expected %d: %+v", len(sessions), len(expected), sessions)
+	}
+	for i, s := range sessions {
+		if s.User != expected[i].User || s.Line != expected[i].Line || s.Host != expected[i].Host || !s.LoginTime.Equal(expected[i].LoginTime) {
+			t.Errorf("session %d: got %+v, expected %+v", i, s, expected[i])
+		}
+	}
+	if ttyType := sessions[0].TTYType(); ttyType != "pts" {
+		t.Errorf("TTYType of %s: got %s, expected pts", sessions[0].Line, ttyType)
+	}
+	if ttyType := sessions[1].TTYType(); ttyType != "tty" {
+		t.Errorf("TTYType of %s: got %s, expected tty", sessions[1].Line, ttyType)
+	}
+}
+
+func TestReadLoginSessionsInvalidSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "utmp")
+	if err := os.WriteFile(path, make([]byte, utmpRecordSize+1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadLoginSessions(path); err == nil {
+		t.Error("expected an error for a truncated utmp file")
+	}
+}
+
+func TestReadLoginSessionsMissingFile(t *testing.T) {
+	sessions, err := ReadLoginSessions(filepath.Join(t.TempDir(), "utmp"))
+	if err != nil || sessions != nil {
+		t.Errorf("got %v, %v, expected no sessions and no error", sessions, err)
+	}
+}